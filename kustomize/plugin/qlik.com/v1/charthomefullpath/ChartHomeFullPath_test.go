@@ -3,6 +3,8 @@ package main_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -80,3 +82,156 @@ metadata:
 releaseName: qliksense
 `)
 }
+
+func TestChartHomeFullPathStaging(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	chartHome, err := ioutil.TempDir("", "chart")
+	require.NoError(t, err)
+	defer os.RemoveAll(chartHome)
+	stagingDir, err := ioutil.TempDir("", "staging")
+	require.NoError(t, err)
+	defer os.RemoveAll(stagingDir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(chartHome, "Chart.yaml"), []byte("name: engine\n"), 0644))
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "ChartHomeFullPath")
+	th := kusttest_test.NewKustTestPluginHarness(t, "/")
+
+	config := `
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: qliksense
+chartHome: ` + chartHome + `
+stagingDir: ` + stagingDir
+	resources := `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+chartName: engine
+`
+	staged := func() string {
+		m := th.LoadAndRunTransformer(config, resources)
+		staged, err := m.Resources()[0].GetString("chartHome")
+		require.NoError(t, err)
+		return staged
+	}
+
+	first := staged()
+	require.True(t, strings.HasPrefix(first, stagingDir+"/engine-"))
+	content, err := ioutil.ReadFile(filepath.Join(first, "Chart.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "name: engine\n", string(content))
+
+	// the same content is staged in the same place
+	require.Equal(t, first, staged())
+
+	// changed content gets a new staging and the old one is removed
+	require.NoError(t, ioutil.WriteFile(filepath.Join(chartHome, "Chart.yaml"), []byte("name: engine\nversion: 2\n"), 0644))
+	second := staged()
+	require.NotEqual(t, first, second)
+	_, err = os.Stat(first)
+	require.True(t, os.IsNotExist(err))
+
+	entries, err := ioutil.ReadDir(stagingDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// files the .helmignore excludes are not staged and do not count
+	require.NoError(t, ioutil.WriteFile(filepath.Join(chartHome, ".helmignore"), []byte("*.swp\n"), 0644))
+	third := staged()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(chartHome, "Chart.yaml.swp"), []byte("draft\n"), 0644))
+	require.Equal(t, third, staged())
+	_, err = os.Stat(filepath.Join(third, "Chart.yaml.swp"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestChartHomeFullPathFieldSpecs(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	base, err := ioutil.TempDir("", "base")
+	require.NoError(t, err)
+	defer os.RemoveAll(base)
+	stagingDir, err := ioutil.TempDir("", "staging")
+	require.NoError(t, err)
+	defer os.RemoveAll(stagingDir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "charts", "engine"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(base, "charts", "engine", "Chart.yaml"), []byte("name: engine\n"), 0644))
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "ChartHomeFullPath")
+	// chartHome is relative to the kustomization listing the transformer
+	th := kusttest_test.NewKustTestPluginHarness(t, base)
+
+	resources := `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+chartName: engine
+chartHome: charts/engine
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: engine
+chartName: engine
+chartHome: charts/engine
+`
+
+	m := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: qliksense
+stagingDir: `+stagingDir, resources)
+
+	chartHome, err := m.Resources()[0].GetString("chartHome")
+	require.NoError(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(chartHome, "Chart.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "name: engine\n", string(content))
+
+	// only kinds in fieldSpecs are changed
+	chartHome, err = m.Resources()[1].GetString("chartHome")
+	require.NoError(t, err)
+	require.Equal(t, "charts/engine", chartHome)
+
+	// other kinds are staged the same way
+	config := `
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: qliksense
+stagingDir: ` + stagingDir + `
+fieldSpecs:
+- kind: ConfigMap
+  path: chartHome
+`
+	m = th.LoadAndRunTransformer(config, resources)
+
+	chartHome, err = m.Resources()[0].GetString("chartHome")
+	require.NoError(t, err)
+	require.Equal(t, "charts/engine", chartHome)
+	chartHome, err = m.Resources()[1].GetString("chartHome")
+	require.NoError(t, err)
+	content, err = ioutil.ReadFile(filepath.Join(chartHome, "Chart.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "name: engine\n", string(content))
+
+	// and need a chartName
+	err = th.ErrorFromLoadAndRunTransformer(config, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: engine
+chartHome: charts/engine
+`)
+	require.EqualError(t, err, "ConfigMap/engine: no chartName is set")
+}
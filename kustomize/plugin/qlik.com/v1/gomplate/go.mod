@@ -3,6 +3,10 @@ module github.com/qlik-trial/qliksense-config/kustomize/plugin/qlik.com/v1/gompl
 go 1.12
 
 require (
+	github.com/qlik-trial/qliksense-config/pkg v0.0.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	sigs.k8s.io/kustomize/v3 v3.1.0
 	sigs.k8s.io/yaml v1.1.0
 )
+
+replace github.com/qlik-trial/qliksense-config/pkg => ../../../../../pkg
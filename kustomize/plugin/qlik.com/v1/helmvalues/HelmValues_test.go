@@ -75,3 +75,95 @@ values:
 `)
 
 }
+
+func TestHelmValuesPluginFalsyValues(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "HelmValues")
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	chart := `
+apiVersion: apps/v1
+kind: HelmChart
+metadata:
+  name: qliksense
+chartName: qliksense
+values:
+  enabled: false
+  debug: true
+  name: ""
+  replicas: 0
+  image: engine
+  tag: v1
+  keep: kept
+`
+
+	// without overwrite the HelmValues only fill in what the chart has not
+	// set, false, "" and 0 included
+	m := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+chartName: qliksense
+values:
+  enabled: true
+  debug: false
+  name: qliksense
+  replicas: 2
+  image: other
+  tag: ""
+  keep: null`, chart)
+
+	th.AssertActualEqualsExpected(m, `
+apiVersion: apps/v1
+chartName: qliksense
+kind: HelmChart
+metadata:
+  name: qliksense
+values:
+  debug: true
+  enabled: true
+  image: engine
+  keep: kept
+  name: qliksense
+  replicas: 2
+  tag: v1
+`)
+
+	// with overwrite the HelmValues win, false and "" included, but null
+	// leaves what the chart has set
+	m = th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+chartName: qliksense
+overwrite: true
+values:
+  enabled: true
+  debug: false
+  name: qliksense
+  replicas: 2
+  image: other
+  tag: ""
+  keep: null`, chart)
+
+	th.AssertActualEqualsExpected(m, `
+apiVersion: apps/v1
+chartName: qliksense
+kind: HelmChart
+metadata:
+  name: qliksense
+values:
+  debug: false
+  enabled: true
+  image: other
+  keep: kept
+  name: qliksense
+  replicas: 2
+  tag: ""
+`)
+}
@@ -1,6 +1,10 @@
 package main_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	kusttest_test "sigs.k8s.io/kustomize/v3/pkg/kusttest"
@@ -62,3 +66,1006 @@ spec:
         working: true
 `)
 }
+
+func TestMultiplePatches(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/patch.yaml", `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qliksense
+spec:
+  template:
+    metadata:
+      labels:
+        working: true
+`)
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: qliksense
+enabled: true
+patches:
+- path: patch.yaml
+  target:
+    name: qliksense
+- patch: |-
+    - op: replace
+      path: /spec/template/metadata/labels/working
+      value: "patched"
+  target:
+    kind: Deployment
+    name: engine
+- patch: |-
+    - op: add
+      path: /spec/template/metadata/labels/order
+      value: "second"
+  target:
+    kind: Deployment
+`,
+		`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qliksense
+spec:
+  template:
+    metadata:
+      labels:
+        working: false
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  template:
+    metadata:
+      labels:
+        working: false
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qliksense
+spec:
+  template:
+    metadata:
+      labels:
+        order: second
+        working: true
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  template:
+    metadata:
+      labels:
+        order: second
+        working: patched
+`)
+}
+
+func TestDefaultTarget(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/mongoconfig.yaml", `
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: component
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        env:
+        - name: MONGO_URI
+          value: mongodb://mongo
+`)
+	th.WriteF("/app/engine.yaml", `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  replicas: 2
+`)
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: qliksense
+enabled: true
+patches:
+- path: mongoconfig.yaml
+- path: engine.yaml
+`,
+		`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine-worker
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: engine
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - env:
+        - name: MONGO_URI
+          value: mongodb://mongo
+        name: main
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine-worker
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: MONGO_URI
+          value: mongodb://mongo
+        name: main
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: engine
+`)
+}
+
+func TestEnabledWhen(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/values.yaml", `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: qlik.com/v1
+  kind: HelmValues
+  metadata:
+    name: qliksense
+  values:
+    global:
+      mongodb:
+        external: false
+- apiVersion: qlik.com/v1
+  kind: HelmValues
+  metadata:
+    name: qliksense
+  values:
+    global:
+      mongodb:
+        external: true
+`)
+
+	resources := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qliksense
+spec:
+  template:
+    metadata:
+      labels:
+        working: false
+`
+	config := `
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: qliksense
+enabledWhen:
+  values: values.yaml
+  condition: %s
+patches:
+- patch: |-
+    apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: qliksense
+    spec:
+      template:
+        metadata:
+          labels:
+            working: true
+`
+
+	rm := th.LoadAndRunTransformer(fmt.Sprintf(config, "global.mongodb.external == true"), resources)
+	th.AssertActualEqualsExpected(rm, strings.Replace(resources, "working: false", "working: true", 1))
+
+	rm = th.LoadAndRunTransformer(fmt.Sprintf(config, "global.redis.enabled"), resources)
+	th.AssertActualEqualsExpected(rm, resources)
+}
+
+func TestInject(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: redis
+enabled: true
+patches:
+- inject:
+    env:
+    - name: REDIS_URI
+      valueFrom:
+        secretKeyRef:
+          key: redis-addr
+          name: redis-secret
+    volumeMounts:
+    - name: certs
+      mountPath: /etc/ssl/certs
+    volumes:
+    - name: certs
+      configMap:
+        name: ca-certs
+- target:
+    kind: StatefulSet
+  inject:
+    containerName: ^sidecar$
+    envFrom:
+    - secretRef:
+        name: sidecar
+`,
+		`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: chronos
+spec:
+  template:
+    spec:
+      containers:
+      - name: chronos
+        env:
+        - name: REDIS_URI
+          value: old
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: engine
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+      - name: sidecar
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: chronos
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: chronos
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: REDIS_URI
+          valueFrom:
+            secretKeyRef:
+              key: redis-addr
+              name: redis-secret
+        name: chronos
+        volumeMounts:
+        - mountPath: /etc/ssl/certs
+          name: certs
+      volumes:
+      - configMap:
+          name: ca-certs
+        name: certs
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: engine
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: REDIS_URI
+          valueFrom:
+            secretKeyRef:
+              key: redis-addr
+              name: redis-secret
+        name: main
+        volumeMounts:
+        - mountPath: /etc/ssl/certs
+          name: certs
+      - env:
+        - name: REDIS_URI
+          valueFrom:
+            secretKeyRef:
+              key: redis-addr
+              name: redis-secret
+        envFrom:
+        - secretRef:
+            name: sidecar
+        name: sidecar
+        volumeMounts:
+        - mountPath: /etc/ssl/certs
+          name: certs
+      volumes:
+      - configMap:
+          name: ca-certs
+        name: certs
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - env:
+            - name: REDIS_URI
+              valueFrom:
+                secretKeyRef:
+                  key: redis-addr
+                  name: redis-secret
+            name: job
+            volumeMounts:
+            - mountPath: /etc/ssl/certs
+              name: certs
+          volumes:
+          - configMap:
+              name: ca-certs
+            name: certs
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: chronos
+`)
+}
+
+func TestInjectStructuredEntries(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	// an env entry replaces the one of the same name whatever their
+	// valueFrom, an envFrom entry is added unless an identical one is there
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: mongo
+enabled: true
+patches:
+- inject:
+    env:
+    - name: MONGO_URI
+      valueFrom:
+        secretKeyRef:
+          key: mongodb-uri
+          name: qliksense-mongoconfig
+    envFrom:
+    - configMapRef:
+        name: mongo
+      prefix: MONGO_
+    - secretRef:
+        name: mongo
+        optional: true
+`,
+		`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: users
+spec:
+  template:
+    spec:
+      containers:
+      - name: users
+        env:
+        - name: MONGO_URI
+          valueFrom:
+            configMapKeyRef:
+              key: uri
+              name: users
+        - name: POD_IP
+          valueFrom:
+            fieldRef:
+              fieldPath: status.podIP
+        envFrom:
+        - configMapRef:
+            name: mongo
+          prefix: MONGO_
+        - secretRef:
+            name: mongo
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: users
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: MONGO_URI
+          valueFrom:
+            secretKeyRef:
+              key: mongodb-uri
+              name: qliksense-mongoconfig
+        - name: POD_IP
+          valueFrom:
+            fieldRef:
+              fieldPath: status.podIP
+        envFrom:
+        - configMapRef:
+            name: mongo
+          prefix: MONGO_
+        - secretRef:
+            name: mongo
+        - secretRef:
+            name: mongo
+            optional: true
+        name: users
+`)
+}
+
+func TestExpectAndOpErrors(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	resources := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  replicas: 1
+`
+
+	err := th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: engine
+enabled: true
+patches:
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+  target:
+    name: engine-renamed
+  expect:
+    min: 1
+`, resources)
+	if err == nil || !strings.Contains(err.Error(), "expected at least 1 matching resources, found 0") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: engine
+enabled: true
+patches:
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+    - op: replace
+      path: /spec/template/spec/missing
+      value: 2
+  target:
+    name: engine
+`, resources)
+	if err == nil || !strings.Contains(err.Error(), "patches[0]: Deployment/engine: op 1 (replace /spec/template/spec/missing)") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// without a target a JSON6902 patch or a JSON merge patch naming no
+	// resource would match nothing, even when it expects to
+	for _, patch := range []string{`
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+  expect:
+    min: 1
+`, `
+- type: jsonMerge
+  patch: |-
+    spec:
+      replicas: 2
+  expect:
+    min: 1
+`} {
+		err = th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: engine
+enabled: true
+patches:`+patch, resources)
+		if err == nil || !strings.Contains(err.Error(), "patches[0]: no target is set and the patch names no resource to default it from") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// kustomize panics on names and namespaces that are not regexes, they
+	// are rejected with the globs before anything is selected
+	for target, expected := range map[string]string{`
+    name: engine[`: "patches[0].target: name: error parsing regexp",
+		`
+    namespace: (qlik`: "patches[0].target: namespace: error parsing regexp",
+		`
+    nameGlob: "[engine"`: "patches[0].target: nameGlob: syntax error in pattern",
+		`
+    kind: Deployment
+    exclude:
+    - name: ^engine$
+    - name: engine[`: "patches[0].target: exclude[1]: name: error parsing regexp",
+	} {
+		err = th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: engine
+enabled: true
+patches:
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+  target:`+target, resources)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	resources := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  replicas: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hub
+spec:
+  replicas: 2
+`
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: replicas
+enabled: true
+dryRun: true
+patches:
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+  target:
+    kind: Deployment
+`, resources)
+	th.AssertActualEqualsExpected(rm, resources)
+
+	w.Close()
+	report, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SelectivePatch replicas patches[0]: 1 changed [Deployment/engine]\n"
+	if string(report) != expected {
+		t.Fatalf("expected report %q, got %q", expected, report)
+	}
+}
+
+func TestPatchTypes(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/engine.yaml", `
+apiVersion: qixmanager.qlik.com/v1
+kind: Engine
+metadata:
+  name: (( .name ))
+spec:
+  podSpec:
+    containers:
+    - name: engine
+      image: (( .image ))
+  metadata: null
+`)
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: engines
+enabled: true
+vars:
+  image: qlikcore/engine:12.1
+patches:
+- path: engine.yaml
+  type: jsonMerge
+  vars:
+    name: reload
+- type: json6902
+  patch: |-
+    - op: add
+      path: /metadata/labels
+      value:
+        release: (( .release ))
+  vars:
+    release: qliksense
+  target:
+    kind: Engine
+`,
+		`apiVersion: qixmanager.qlik.com/v1
+kind: Engine
+metadata:
+  name: reload
+spec:
+  podSpec:
+    containers:
+    - name: engine
+      image: qlikcore/engine:12.0
+    - name: sidecar
+  metadata:
+    annotations:
+      old: true
+---
+apiVersion: qixmanager.qlik.com/v1
+kind: Engine
+metadata:
+  name: interactive
+spec:
+  metadata:
+    annotations:
+      old: true
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qixmanager.qlik.com/v1
+kind: Engine
+metadata:
+  labels:
+    release: qliksense
+  name: reload
+spec:
+  podSpec:
+    containers:
+    - image: qlikcore/engine:12.1
+      name: engine
+---
+apiVersion: qixmanager.qlik.com/v1
+kind: Engine
+metadata:
+  labels:
+    release: qliksense
+  name: interactive
+spec:
+  metadata:
+    annotations:
+      old: true
+`)
+
+	err := th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: engines
+enabled: true
+patches:
+- path: engine.yaml
+  type: mergePatch
+`, "")
+	if err == nil || !strings.Contains(err.Error(), `unknown patch type "mergePatch"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: selectors
+enabled: true
+patches:
+- target:
+    kind: Secret
+    nameGlob: "*-redis"
+  patch: |-
+    - op: add
+      path: /metadata/annotations
+      value:
+        redis: "true"
+- target:
+    kind: Deployment
+    exclude:
+    - name: ^engine$
+  type: jsonMerge
+  patch: |-
+    spec:
+      replicas: 2
+- target:
+    chart: qix-sessions
+  patch: |-
+    - op: add
+      path: /metadata/annotations
+      value:
+        chart: qix-sessions
+`,
+		`apiVersion: v1
+kind: Secret
+metadata:
+  name: chronos-redis
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: redis-chronos
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qix-sessions
+  labels:
+    helm.sh/chart: qix-sessions-2.1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qix-sessions-redis
+  labels:
+    chart: qix-sessions-redis-1.0.0
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: v1
+kind: Secret
+metadata:
+  annotations:
+    redis: "true"
+  name: chronos-redis
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: redis-chronos
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    chart: qix-sessions
+  labels:
+    helm.sh/chart: qix-sessions-2.1.0
+  name: qix-sessions
+spec:
+  replicas: 2
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    chart: qix-sessions-redis-1.0.0
+  name: qix-sessions-redis
+spec:
+  replicas: 2
+`)
+}
+
+func TestChartAnnotations(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "SelectivePatch")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	// the provenance is in an annotation when the chart sets no label, a
+	// label takes precedence over the annotations
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: SelectivePatch
+metadata:
+  name: selectors
+enabled: true
+patches:
+- target:
+    chart: qix-sessions
+  type: jsonMerge
+  patch: |-
+    spec:
+      replicas: 2
+`,
+		`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qix-sessions
+  annotations:
+    helm.sh/chart: qix-sessions-2.1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: qix-sessions-redis
+  labels:
+    chart: qix-sessions-redis-1.0.0
+  annotations:
+    chart: qix-sessions
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+`,
+	)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    helm.sh/chart: qix-sessions-2.1.0
+  name: qix-sessions
+spec:
+  replicas: 2
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    chart: qix-sessions
+  labels:
+    chart: qix-sessions-redis-1.0.0
+  name: qix-sessions-redis
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: engine
+`)
+}
@@ -1,6 +1,9 @@
 package main_test
 
 import (
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 
 	kusttest_test "sigs.k8s.io/kustomize/v3/pkg/kusttest"
@@ -65,3 +68,382 @@ values:
       working: 123
 `)
 }
+
+func TestValuesFileTarget(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "ValuesFile")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/values.yaml", `
+global:
+  region: (( (ds "data").REGION ))
+`)
+	os.Setenv("QLIK_TEST_REGION", "us-east-1")
+	defer os.Unsetenv("QLIK_TEST_REGION")
+
+	resources := `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+chartName: engine
+---
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: engine
+data:
+  region: eu-west-1
+`
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: true
+valuesFile: values.yaml
+dataSource:
+  type: env
+  env:
+    prefix: QLIK_TEST_
+`, resources)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+chartName: engine
+kind: HelmChart
+metadata:
+  name: engine
+values:
+  global:
+    region: us-east-1
+---
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+values:
+  global:
+    region: us-east-1
+---
+apiVersion: v1
+data:
+  region: eu-west-1
+kind: ConfigMap
+metadata:
+  name: engine
+`)
+
+	rm = th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: true
+valuesFile: values.yaml
+target:
+  kind: HelmChart
+  name: engine
+dataSource:
+  type: env
+  env:
+    prefix: QLIK_TEST_
+`, resources)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+chartName: engine
+kind: HelmChart
+metadata:
+  name: engine
+values:
+  global:
+    region: us-east-1
+---
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+---
+apiVersion: v1
+data:
+  region: eu-west-1
+kind: ConfigMap
+metadata:
+  name: engine
+`)
+
+	err := th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: true
+valuesFile: values.yaml
+target:
+  kind: HelmChart
+  name: engine[
+`, resources)
+	if err == nil || !strings.Contains(err.Error(), "target: name: error parsing regexp") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValuesFileCharts(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "ValuesFile")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/values.yaml", `
+global:
+  region: us-east-1
+---
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: engine
+values:
+  replicas: 3
+---
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: collections
+values:
+  mongodb:
+    uri: mongodb://mongodb:27017
+`)
+
+	resources := `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: qliksense-engine
+chartName: engine
+---
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: collections
+chartName: collections
+`
+
+	config := `
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: %t
+valuesFile: values.yaml
+dataSource:
+  type: env
+`
+
+	rm := th.LoadAndRunTransformer(fmt.Sprintf(config, true), resources)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+chartName: engine
+kind: HelmChart
+metadata:
+  name: qliksense-engine
+values:
+  global:
+    region: us-east-1
+  replicas: 3
+---
+apiVersion: qlik.com/v1
+chartName: collections
+kind: HelmChart
+metadata:
+  name: collections
+values:
+  global:
+    region: us-east-1
+  mongodb:
+    uri: mongodb://mongodb:27017
+`)
+
+	rm = th.LoadAndRunTransformer(fmt.Sprintf(config, false), resources)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+chartName: engine
+kind: HelmChart
+metadata:
+  name: qliksense-engine
+---
+apiVersion: qlik.com/v1
+chartName: collections
+kind: HelmChart
+metadata:
+  name: collections
+`)
+}
+
+func TestValuesFilePrecedence(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "ValuesFile")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/values.yaml", `
+config:
+  testing: true
+  replicas: 3
+  hosts:
+  - file.example.com
+  debug: null
+  mongodb:
+    uri: mongodb://file:27017
+`)
+
+	resources := `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+values:
+  config:
+    testing: false
+    hosts:
+    - resource.example.com
+    - other.example.com
+    debug: true
+    mongodb:
+      database: qliksense
+    image: engine
+`
+
+	config := `
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: true
+valuesFile: values.yaml
+dataSource:
+  type: env
+%s
+`
+
+	for _, precedence := range []string{"", "precedence: file"} {
+		rm := th.LoadAndRunTransformer(fmt.Sprintf(config, precedence), resources)
+
+		th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+values:
+  config:
+    hosts:
+    - file.example.com
+    image: engine
+    mongodb:
+      database: qliksense
+      uri: mongodb://file:27017
+    replicas: 3
+    testing: true
+`)
+	}
+
+	rm := th.LoadAndRunTransformer(fmt.Sprintf(config, "precedence: resource"), resources)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+values:
+  config:
+    debug: true
+    hosts:
+    - resource.example.com
+    - other.example.com
+    image: engine
+    mongodb:
+      database: qliksense
+      uri: mongodb://file:27017
+    replicas: 3
+    testing: false
+`)
+
+	err := th.ErrorFromLoadAndRunTransformer(fmt.Sprintf(config, "precedence: chart"), resources)
+	if err == nil || !strings.Contains(err.Error(), `unknown precedence "chart"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValuesFileWithoutDataSource(t *testing.T) {
+	tc := plugins_test.NewEnvForTest(t).Set()
+	defer tc.Reset()
+
+	tc.BuildGoPlugin(
+		"qlik.com", "v1", "ValuesFile")
+
+	th := kusttest_test.NewKustTestPluginHarness(t, "/app")
+
+	th.WriteF("/app/env/values.yaml", `
+ingress:
+  annotation: (( not a template ))
+`)
+
+	rm := th.LoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: true
+valuesFile: env/values.yaml
+`, `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+`)
+
+	th.AssertActualEqualsExpected(rm, `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+values:
+  ingress:
+    annotation: (( not a template ))
+`)
+
+	err := th.ErrorFromLoadAndRunTransformer(`
+apiVersion: qlik.com/v1
+kind: ValuesFile
+metadata:
+  name: qliksense
+enabled: true
+valuesFile: missing.yaml
+`, `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+`)
+	if err == nil || !strings.Contains(err.Error(), "values file missing.yaml is not found") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -3,7 +3,9 @@ module github.com/qlik-trial/qliksense-config/kustomize/plugin/qlik.com/v1/value
 go 1.12
 
 require (
-	github.com/imdario/mergo v0.3.7
+	github.com/qlik-trial/qliksense-config/pkg v0.0.0
 	sigs.k8s.io/kustomize/v3 v3.1.0
 	sigs.k8s.io/yaml v1.1.0
 )
+
+replace github.com/qlik-trial/qliksense-config/pkg => ../../../../../pkg
@@ -0,0 +1,243 @@
+// Package argocd generates the ArgoCD Applications of the components of a
+// profile, so that they follow the kustomizations under configs instead of
+// being listed by hand.
+package argocd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/build"
+)
+
+const (
+	// APIVersion is the apiVersion of ArgoCD's resources
+	APIVersion = "argoproj.io/v1alpha1"
+	// SyncWaveAnnotation orders the sync of Applications, lower waves first
+	SyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+)
+
+// Options are the settings the Applications share.
+type Options struct {
+	// RepoURL is the repo holding configs
+	RepoURL string
+	// Revision is the branch, tag or commit of RepoURL, its HEAD when empty
+	Revision string
+	// Path is the directory of configs in RepoURL
+	Path string
+	// Namespace is the namespace the Applications are created in
+	Namespace string
+	// Project is the ArgoCD project of the Applications
+	Project string
+	// Server is the API server of the cluster the components are deployed to
+	Server string
+	// DestinationNamespace is the namespace the components are deployed to
+	DestinationNamespace string
+	// Automated syncs the Applications whenever the repo changes
+	Automated bool
+	// Prune deletes the resources a component no longer renders on automated
+	// syncs
+	Prune bool
+	// SelfHeal reverts changes made in the cluster on automated syncs
+	SelfHeal bool
+	// Prerequisites are directories of RepoURL outside of configs, such as
+	// the CRDs of resources, each deployed by an Application named after it
+	// in the wave before the components
+	Prerequisites []string
+}
+
+// DefaultOptions are the settings argocd/apps.yaml is generated with.
+var DefaultOptions = Options{
+	RepoURL:              "https://github.com/qlik-trial/qliksense-qlikconfig.git",
+	Path:                 build.DefaultConfigs,
+	Namespace:            "argocd",
+	Project:              "qliksense",
+	Server:               "https://kubernetes.default.svc",
+	DestinationNamespace: "qliksense",
+	Automated:            true,
+	Prune:                true,
+	Prerequisites:        []string{"resources"},
+}
+
+// Application is an ArgoCD Application of a component.
+type Application struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   Metadata `json:"metadata"`
+	Spec       Spec     `json:"spec"`
+	wave       int
+}
+
+// Metadata is the metadata of an Application.
+type Metadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Spec is the spec of an Application.
+type Spec struct {
+	Destination Destination `json:"destination"`
+	Project     string      `json:"project"`
+	Source      Source      `json:"source"`
+	SyncPolicy  *SyncPolicy `json:"syncPolicy,omitempty"`
+}
+
+// Destination is the cluster and namespace an Application deploys to.
+type Destination struct {
+	Namespace string `json:"namespace,omitempty"`
+	Server    string `json:"server"`
+}
+
+// Source is the kustomization an Application deploys.
+type Source struct {
+	Path           string `json:"path"`
+	RepoURL        string `json:"repoURL"`
+	TargetRevision string `json:"targetRevision,omitempty"`
+}
+
+// SyncPolicy is when and how an Application syncs.
+type SyncPolicy struct {
+	Automated *Automated `json:"automated,omitempty"`
+}
+
+// Automated are the settings of automated syncs.
+type Automated struct {
+	Prune    bool `json:"prune,omitempty"`
+	SelfHeal bool `json:"selfHeal,omitempty"`
+}
+
+// List is the v1 List the Applications are written in.
+type List struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Items      []Application `json:"items"`
+}
+
+// NewList returns a List of the Applications.
+func NewList(applications []Application) List {
+	return List{APIVersion: "v1", Kind: "List", Items: applications}
+}
+
+// Wave returns the sync wave of the Application.
+func (a Application) Wave() int {
+	return a.wave
+}
+
+// Applications returns an Application for each of the prerequisites, in wave
+// -1, and for each component of the profile in configs, in the order of the
+// profile. A component is in the sync wave after the last of the components
+// it depends on, see build.Dependencies.
+func Applications(configs string, profile string, options Options) ([]Application, error) {
+	components, err := build.Components(configs, profile)
+	if err != nil {
+		return nil, err
+	}
+	dependencies, err := build.Dependencies(configs, profile)
+	if err != nil {
+		return nil, err
+	}
+	waves, err := Waves(dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	var syncPolicy *SyncPolicy
+	if options.Automated {
+		syncPolicy = &SyncPolicy{Automated: &Automated{Prune: options.Prune, SelfHeal: options.SelfHeal}}
+	}
+	newApplication := func(name string, repoPath string, wave int) Application {
+		a := Application{
+			APIVersion: APIVersion,
+			Kind:       "Application",
+			Metadata:   Metadata{Name: name, Namespace: options.Namespace},
+			Spec: Spec{
+				Destination: Destination{Namespace: options.DestinationNamespace, Server: options.Server},
+				Project:     options.Project,
+				Source: Source{
+					Path:           repoPath,
+					RepoURL:        options.RepoURL,
+					TargetRevision: options.Revision,
+				},
+				SyncPolicy: syncPolicy,
+			},
+			wave: wave,
+		}
+		// wave 0 is ArgoCD's default
+		if wave != 0 {
+			a.Metadata.Annotations = map[string]string{SyncWaveAnnotation: strconv.Itoa(wave)}
+		}
+		return a
+	}
+
+	var applications []Application
+	names := map[string]bool{}
+	for _, prerequisite := range options.Prerequisites {
+		name := path.Base(prerequisite)
+		if names[name] {
+			return nil, fmt.Errorf("prerequisite %s is named as another Application", prerequisite)
+		}
+		names[name] = true
+		applications = append(applications, newApplication(name, prerequisite, -1))
+	}
+	for _, component := range components {
+		if names[component] {
+			return nil, fmt.Errorf("component %s is named as a prerequisite", component)
+		}
+		applications = append(applications, newApplication(component, path.Join(options.Path, profile, component), waves[component]))
+	}
+	return applications, nil
+}
+
+// Waves returns the sync wave of each component, 0 for those depending on
+// none and one more than the highest wave of its dependencies for the rest.
+func Waves(dependencies map[string][]string) (map[string]int, error) {
+	waves := map[string]int{}
+	var names []string
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := wave(name, dependencies, waves, nil); err != nil {
+			return nil, err
+		}
+	}
+	return waves, nil
+}
+
+func wave(name string, dependencies map[string][]string, waves map[string]int, chain []string) (int, error) {
+	if w, ok := waves[name]; ok {
+		return w, nil
+	}
+	for i, visiting := range chain {
+		if visiting == name {
+			return 0, fmt.Errorf("dependency cycle %s", strings.Join(append(chain[i:], name), " -> "))
+		}
+	}
+	w := 0
+	for _, dependency := range dependencies[name] {
+		dw, err := wave(dependency, dependencies, waves, append(chain, name))
+		if err != nil {
+			return 0, err
+		}
+		if dw+1 > w {
+			w = dw + 1
+		}
+	}
+	waves[name] = w
+	return w, nil
+}
+
+// SyncOrder returns the Applications by sync wave, in their order within a
+// wave.
+func SyncOrder(applications []Application) []Application {
+	sorted := append([]Application{}, applications...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].wave < sorted[j].wave
+	})
+	return sorted
+}
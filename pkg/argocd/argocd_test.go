@@ -0,0 +1,130 @@
+package argocd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestApplications(t *testing.T) {
+	configs, err := ioutil.TempDir("", "argocd")
+	require.NoError(t, err)
+	defer os.RemoveAll(configs)
+	for name, content := range map[string]string{
+		"qseok/kustomization.yaml":                        "resources:\n- audit\n- qliksense\n",
+		"qseok/audit/kustomization.yaml":                  "transformers:\n- ../qliksense/transformers\n",
+		"qseok/qliksense/kustomization.yaml":              "resources: []\n",
+		"qseok/qliksense/transformers/kustomization.yaml": "resources: []\n",
+	} {
+		path := filepath.Join(configs, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	options := DefaultOptions
+	options.Revision = "v1.0.0"
+	applications, err := Applications(configs, "qseok", options)
+	require.NoError(t, err)
+	list, err := yaml.Marshal(NewList(applications))
+	require.NoError(t, err)
+	require.Equal(t, `apiVersion: v1
+items:
+- apiVersion: argoproj.io/v1alpha1
+  kind: Application
+  metadata:
+    annotations:
+      argocd.argoproj.io/sync-wave: "-1"
+    name: resources
+    namespace: argocd
+  spec:
+    destination:
+      namespace: qliksense
+      server: https://kubernetes.default.svc
+    project: qliksense
+    source:
+      path: resources
+      repoURL: https://github.com/qlik-trial/qliksense-qlikconfig.git
+      targetRevision: v1.0.0
+    syncPolicy:
+      automated:
+        prune: true
+- apiVersion: argoproj.io/v1alpha1
+  kind: Application
+  metadata:
+    annotations:
+      argocd.argoproj.io/sync-wave: "1"
+    name: audit
+    namespace: argocd
+  spec:
+    destination:
+      namespace: qliksense
+      server: https://kubernetes.default.svc
+    project: qliksense
+    source:
+      path: configs/qseok/audit
+      repoURL: https://github.com/qlik-trial/qliksense-qlikconfig.git
+      targetRevision: v1.0.0
+    syncPolicy:
+      automated:
+        prune: true
+- apiVersion: argoproj.io/v1alpha1
+  kind: Application
+  metadata:
+    name: qliksense
+    namespace: argocd
+  spec:
+    destination:
+      namespace: qliksense
+      server: https://kubernetes.default.svc
+    project: qliksense
+    source:
+      path: configs/qseok/qliksense
+      repoURL: https://github.com/qlik-trial/qliksense-qlikconfig.git
+      targetRevision: v1.0.0
+    syncPolicy:
+      automated:
+        prune: true
+kind: List
+`, string(list))
+
+	var order []string
+	for _, a := range SyncOrder(applications) {
+		order = append(order, a.Metadata.Name)
+	}
+	require.Equal(t, []string{"resources", "qliksense", "audit"}, order)
+
+	// prerequisites and components share the names of the Applications
+	options.Prerequisites = []string{"qliksense"}
+	_, err = Applications(configs, "qseok", options)
+	require.EqualError(t, err, "component qliksense is named as a prerequisite")
+
+	// without automated syncs there is no sync policy
+	options.Automated = false
+	options.Prerequisites = nil
+	applications, err = Applications(configs, "qseok", options)
+	require.NoError(t, err)
+	require.Len(t, applications, 2)
+	require.Nil(t, applications[0].Spec.SyncPolicy)
+}
+
+func TestWaves(t *testing.T) {
+	waves, err := Waves(map[string][]string{
+		"mongodb":   {},
+		"qliksense": {},
+		"users":     {"qliksense", "mongodb"},
+		"edge-auth": {"users"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"mongodb": 0, "qliksense": 0, "users": 1, "edge-auth": 2}, waves)
+
+	_, err = Waves(map[string][]string{
+		"engine":  {"users"},
+		"users":   {"tenants"},
+		"tenants": {"users"},
+	})
+	require.EqualError(t, err, "dependency cycle users -> tenants -> users")
+}
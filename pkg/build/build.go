@@ -0,0 +1,249 @@
+// Package build renders the profiles under configs and their components with
+// the qlik.com/v1 plugins of the running executable, so that neither the Go
+// plugins nor the exec plugin have to be installed where kustomize looks for
+// them.
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/function"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/pkg/git"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/loader"
+	kplugins "sigs.k8s.io/kustomize/v3/pkg/plugins"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/target"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultConfigs is the directory of the profiles in this repo
+const DefaultConfigs = "configs"
+
+const kustomizationFile = "kustomization.yaml"
+
+// optionsFile holds the Options of a Build in its plugin directory, for the
+// plugins it runs
+const optionsFile = "options.json"
+
+// Options change how kustomizations are built.
+type Options struct {
+	// LoadRestrictor is kustomize's --load_restrictor, rootOnly, the
+	// default, or none
+	LoadRestrictor string `json:"loadRestrictor,omitempty"`
+}
+
+func (o Options) loadRestrictor() (loader.LoadRestrictorFunc, error) {
+	return plugins.LoadRestrictor(o.LoadRestrictor)
+}
+
+// Build builds the kustomization in path as kustomize build
+// --enable_alpha_plugins does. The running executable is installed as the
+// exec plugin of each qlik.com/v1 kind in a plugin directory of its own, so
+// programs calling Build have to call PluginMain first.
+func Build(path string, options Options) (resmap.ResMap, error) {
+	lr, err := options.loadRestrictor()
+	if err != nil {
+		return nil, err
+	}
+	// plugins installed for kustomize are not used, so builds do not depend on
+	// what is installed where they run
+	pluginDir, err := ioutil.TempDir("", "qliksense-config-plugins")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(pluginDir)
+	if err := installPlugins(pluginDir, options); err != nil {
+		return nil, err
+	}
+
+	ldr, err := plugins.NewLoader(lr, path)
+	if err != nil {
+		return nil, err
+	}
+	defer ldr.Cleanup()
+	rf := plugins.NewFactory()
+	pc := &types.PluginConfig{DirectoryPath: pluginDir, Enabled: true}
+	kt, err := target.NewKustTarget(ldr, rf, transformer.NewFactoryImpl(), kplugins.NewLoader(pc, rf))
+	if err != nil {
+		return nil, err
+	}
+	return kt.MakeCustomizedResMap()
+}
+
+// installPlugins links the running executable as the exec plugin of each
+// kind in pluginDir, <pluginDir>/qlik.com/v1/<lower case kind>/<kind>, and
+// writes the options there.
+func installPlugins(pluginDir string, options Options) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	for _, kind := range plugins.Kinds() {
+		dir := filepath.Join(pluginDir, plugins.APIVersion, strings.ToLower(kind))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(executable, filepath.Join(dir, kind)); err != nil {
+			return err
+		}
+	}
+	content, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(pluginDir, optionsFile), content, 0644)
+}
+
+// PluginMain runs the process as the exec plugin Build started it as and
+// exits, it returns when the process was started otherwise.
+func PluginMain() {
+	kind := filepath.Base(os.Args[0])
+	if _, err := plugins.New(kind); err != nil || len(os.Args) < 2 {
+		return
+	}
+	if err := runPlugin(os.Args[0], os.Args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", kind, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func runPlugin(executable string, configFile string) error {
+	pluginDir := filepath.Join(filepath.Dir(executable), "..", "..", "..")
+	content, err := ioutil.ReadFile(filepath.Join(pluginDir, optionsFile))
+	if err != nil {
+		return err
+	}
+	var options Options
+	if err := json.Unmarshal(content, &options); err != nil {
+		return err
+	}
+	config, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	ldr, err := pluginLoader(options, os.Getenv("KUSTOMIZE_PLUGIN_CONFIG_ROOT"))
+	if err != nil {
+		return err
+	}
+	defer ldr.Cleanup()
+	return function.RunExec(config, os.Stdin, os.Stdout, ldr)
+}
+
+// pluginLoader returns the loader of a plugin configured in root, restricted
+// as the kustomization listing it is
+func pluginLoader(options Options, root string) (ifc.Loader, error) {
+	lr, err := options.loadRestrictor()
+	if err != nil {
+		return nil, err
+	}
+	return plugins.NewLoader(lr, root)
+}
+
+// Path returns the directory of the profile in configs, or of one of its
+// components when component is not empty.
+func Path(configs string, profile string, component string) (string, error) {
+	profiles, err := Profiles(configs)
+	if err != nil {
+		return "", err
+	}
+	if !contains(profiles, profile) {
+		return "", fmt.Errorf("unknown profile %q, expected one of %v", profile, profiles)
+	}
+	if component == "" {
+		return filepath.Join(configs, profile), nil
+	}
+	components, err := Components(configs, profile)
+	if err != nil {
+		return "", err
+	}
+	if !contains(components, component) {
+		return "", fmt.Errorf("profile %s has no component %q, expected one of %v", profile, component, components)
+	}
+	return filepath.Join(configs, profile, component), nil
+}
+
+// Profiles returns the names of the profiles in configs, the directories
+// holding a kustomization.
+func Profiles(configs string) ([]string, error) {
+	entries, err := ioutil.ReadDir(configs)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(configs, entry.Name(), kustomizationFile)); err == nil {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// Components returns the components of the profile in the order its
+// kustomization lists them, they are its resources in directories of the
+// profile.
+func Components(configs string, profile string) ([]string, error) {
+	dir := filepath.Join(configs, profile)
+	k, err := readKustomization(configs, profile)
+	if err != nil {
+		return nil, err
+	}
+	var components []string
+	for _, resource := range append(k.Bases, k.Resources...) {
+		if _, err := git.NewRepoSpecFromUrl(resource); err == nil {
+			continue
+		}
+		if strings.Contains(filepath.Clean(resource), string(filepath.Separator)) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(dir, resource)); err == nil && info.IsDir() {
+			components = append(components, filepath.Clean(resource))
+		}
+	}
+	return components, nil
+}
+
+// Namespace returns the namespace the kustomization of the profile puts its
+// components in, they have none of their own.
+func Namespace(configs string, profile string) (string, error) {
+	k, err := readKustomization(configs, profile)
+	if err != nil {
+		return "", err
+	}
+	return k.Namespace, nil
+}
+
+func readKustomization(configs string, profile string) (*types.Kustomization, error) {
+	content, err := ioutil.ReadFile(filepath.Join(configs, profile, kustomizationFile))
+	if err != nil {
+		return nil, err
+	}
+	var k types.Kustomization
+	if err := yaml.Unmarshal(content, &k); err != nil {
+		return nil, fmt.Errorf("%s: %v", profile, err)
+	}
+	return &k, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,427 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qlik-trial/qliksense-config/pkg/diff"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/v3/pkg/git"
+	"sigs.k8s.io/kustomize/v3/pkg/transformers"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestBuild(t *testing.T) {
+	configs, err := ioutil.TempDir("", "build")
+	require.NoError(t, err)
+	defer os.RemoveAll(configs)
+	writeFiles(t, configs, map[string]string{
+		"qseok/kustomization.yaml": `
+namespace: qliksense
+resources:
+- chronos
+- https://github.com/qlik-oss/chronos-app//manifests
+`,
+		"qseok/chronos/kustomization.yaml": `
+resources:
+- chart.yaml
+transformers:
+- values.yaml
+`,
+		"qseok/chronos/chart.yaml": `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: chronos
+chartName: chronos
+`,
+		"qseok/chronos/values.yaml": `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: chronos
+values:
+  replicas: 2
+`,
+		"qseok/notes/README.md":            "not a component\n",
+		"qseok_devmode/kustomization.yaml": "resources: []\n",
+		"README.md":                        "not a profile\n",
+	})
+
+	profiles, err := Profiles(configs)
+	require.NoError(t, err)
+	require.Equal(t, []string{"qseok", "qseok_devmode"}, profiles)
+
+	components, err := Components(configs, "qseok")
+	require.NoError(t, err)
+	require.Equal(t, []string{"chronos"}, components)
+
+	namespace, err := Namespace(configs, "qseok")
+	require.NoError(t, err)
+	require.Equal(t, "qliksense", namespace)
+
+	path, err := Path(configs, "qseok", "chronos")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(configs, "qseok", "chronos"), path)
+	_, err = Path(configs, "qseok_ent", "")
+	require.EqualError(t, err, `unknown profile "qseok_ent", expected one of [qseok qseok_devmode]`)
+	_, err = Path(configs, "qseok", "redis")
+	require.EqualError(t, err, `profile qseok has no component "redis", expected one of [chronos]`)
+
+	// the HelmValues transformer runs without any plugin installed, as an exec
+	// plugin reading the values back from YAML
+	m, err := Build(path, Options{})
+	require.NoError(t, err)
+	require.Len(t, m.Resources(), 1)
+	replicas, err := m.Resources()[0].GetFieldValue("values.replicas")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), replicas)
+
+	_, err = Build(path, Options{LoadRestrictor: "any"})
+	require.EqualError(t, err, `unknown load restrictor "any", expected rootOnly or none`)
+}
+
+func TestDependencies(t *testing.T) {
+	configs, err := ioutil.TempDir("", "dependencies")
+	require.NoError(t, err)
+	defer os.RemoveAll(configs)
+	writeFiles(t, configs, map[string]string{
+		"qseok/kustomization.yaml": `
+resources:
+- qliksense
+- audit
+- mongodb
+`,
+		"qseok/qliksense/kustomization.yaml":              "resources: []\n",
+		"qseok/qliksense/transformers/kustomization.yaml": "resources: []\n",
+		"qseok/audit/kustomization.yaml": `
+resources:
+- https://github.com/qlik-oss/audit//manifests
+transformers:
+- transformers
+patchesStrategicMerge:
+- |-
+  kind: Deployment
+  metadata:
+    name: audit
+`,
+		"qseok/audit/transformers/kustomization.yaml": `
+resources:
+- ../../qliksense/transformers
+`,
+		"qseok/mongodb/kustomization.yaml": `
+patchesJson6902:
+- path: ../values/mongodb.yaml
+`,
+		"qseok/values/mongodb.yaml": "[]\n",
+		"qseok_devmode/kustomization.yaml": `
+resources:
+- audit
+- qliksense
+`,
+		"qseok_devmode/audit/kustomization.yaml":     "resources:\n- ../../qseok/audit\n",
+		"qseok_devmode/qliksense/kustomization.yaml": "resources:\n- ../../qseok/qliksense\n",
+	})
+
+	dependencies, err := Dependencies(configs, "qseok")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"qliksense": {},
+		"audit":     {"qliksense"},
+		"mongodb":   {},
+	}, dependencies)
+
+	// the devmode components depend on qliksense through those of qseok
+	dependencies, err = Dependencies(configs, "qseok_devmode")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"audit":     {"qliksense"},
+		"qliksense": {},
+	}, dependencies)
+}
+
+func TestBuildRemoteChartHome(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	remotes := filepath.Join(dir, "remotes")
+	stagingDir := filepath.Join(dir, "staging")
+	for key, value := range remotesEnv(remotes) {
+		defer setenv(t, key, value)()
+	}
+
+	writeFiles(t, filepath.Join(remotes, "engine-app.git"), map[string]string{
+		"generators/kustomization.yaml": `
+resources:
+- helmchart.yaml
+transformers:
+- charthome.yaml
+`,
+		"generators/helmchart.yaml": `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+chartName: engine
+chartHome: chart
+`,
+		"generators/charthome.yaml": `
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: engine
+stagingDir: ` + stagingDir + `
+`,
+		"generators/chart/Chart.yaml": "name: engine\nversion: 1.0.0\n",
+		// a base leaving its chart to be staged by the overlays
+		"bare/kustomization.yaml": `
+resources:
+- helmchart.yaml
+`,
+		"bare/helmchart.yaml": `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+chartName: engine
+chartHome: ../generators/chart
+`,
+	})
+	commitRepo(t, filepath.Join(remotes, "engine-app.git"))
+
+	writeFiles(t, dir, map[string]string{
+		// the base stages the chart of the copy kustomize fetched
+		"configs/qseok/kustomization.yaml": `
+resources:
+- https://github.com/qlik-oss/engine-app//generators
+`,
+		// an overlay stages the chart of a remote chartHome
+		"configs/qseok_ent/kustomization.yaml": `
+resources:
+- helmchart.yaml
+transformers:
+- charthome.yaml
+`,
+		"configs/qseok_ent/helmchart.yaml": `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+chartName: engine
+`,
+		"configs/qseok_ent/charthome.yaml": `
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: engine
+chartHome: https://github.com/qlik-oss/engine-app//generators/chart
+stagingDir: ` + stagingDir + `
+`,
+		// an overlay stages the chart of a remote base relative to the base
+		"configs/qseok_devmode/kustomization.yaml": `
+resources:
+- https://github.com/qlik-oss/engine-app//bare
+transformers:
+- charthome.yaml
+`,
+		"configs/qseok_devmode/charthome.yaml": `
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: engine
+stagingDir: ` + stagingDir + `
+`,
+	})
+
+	for _, profile := range []string{"qseok", "qseok_ent", "qseok_devmode"} {
+		m, err := Build(filepath.Join(dir, "configs", profile), Options{})
+		require.NoError(t, err, profile)
+		require.Len(t, m.Resources(), 1)
+		chartHome, err := m.Resources()[0].GetString("chartHome")
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(chartHome, filepath.Join(stagingDir, "engine-")), chartHome)
+		content, err := ioutil.ReadFile(filepath.Join(chartHome, "Chart.yaml"))
+		require.NoError(t, err)
+		require.Equal(t, "name: engine\nversion: 1.0.0\n", string(content))
+	}
+}
+
+// TestBuildChartPatches builds twice with two releases of a chart with
+// chartPatches staged once, HelmChart changes the chart as it applies the
+// patches and must leave the staging as it was.
+func TestBuildChartPatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chartpatches")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stagingDir := filepath.Join(dir, "staging")
+	defer setenv(t, "PATH", fakeBinDir(t, dir)+string(os.PathListSeparator)+os.Getenv("PATH"))()
+
+	writeFiles(t, dir, map[string]string{
+		"app/kustomization.yaml": `
+generators:
+- generators
+`,
+		"app/generators/kustomization.yaml": `
+resources:
+- helmchart.yaml
+transformers:
+- charthome.yaml
+`,
+		"app/generators/helmchart.yaml": `
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine-a
+chartName: engine
+chartHome: ../chart
+releaseName: a
+releaseNamespace: qliksense
+chartPatches: patches
+---
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine-b
+chartName: engine
+chartHome: ../chart
+releaseName: b
+releaseNamespace: qliksense
+chartPatches: patches
+`,
+		"app/generators/charthome.yaml": `
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: engine
+stagingDir: ` + stagingDir + `
+`,
+		"app/chart/Chart.yaml": "name: engine\nversion: 1.0.0\n",
+		"app/chart/templates/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-engine
+spec:
+  replicas: 1
+`,
+		// ? is replaced with the release name of each HelmChart
+		"app/chart/patches/kustomization.yaml": `
+patchesJson6902:
+- target:
+    group: apps
+    version: v1
+    kind: Deployment
+    name: "?engine"
+  path: replicas.yaml
+`,
+		"app/chart/patches/replicas.yaml": `
+- op: replace
+  path: /spec/replicas
+  value: 2
+`,
+	})
+
+	for i := 0; i < 2; i++ {
+		m, err := Build(filepath.Join(dir, "app"), Options{})
+		require.NoError(t, err, "build %d", i)
+		got, err := m.AsYaml()
+		require.NoError(t, err)
+		require.Equal(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a-engine
+spec:
+  replicas: 2
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: b-engine
+spec:
+  replicas: 2
+`, string(got), "build %d", i)
+	}
+	entries, err := ioutil.ReadDir(stagingDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+// TestPluginRoles checks that the kustomizations under configs list the
+// configs of generators under generators and those of transformers under
+// transformers, kustomize fails with "not a generator" otherwise.
+func TestPluginRoles(t *testing.T) {
+	configs := filepath.Join(repoRoot, DefaultConfigs)
+	err := filepath.Walk(configs, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Name() != kustomizationFile {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		var k types.Kustomization
+		require.NoError(t, yaml.Unmarshal(content, &k), path)
+		dir := filepath.Dir(path)
+		for _, generator := range k.Generators {
+			for _, kind := range pluginKinds(t, filepath.Join(dir, generator)) {
+				_, ok := newPlugin(t, kind).(transformers.Generator)
+				require.True(t, ok, "%s lists %s, a %s, under generators", path, generator, kind)
+			}
+		}
+		for _, transformer := range k.Transformers {
+			for _, kind := range pluginKinds(t, filepath.Join(dir, transformer)) {
+				_, ok := newPlugin(t, kind).(transformers.Transformer)
+				require.True(t, ok, "%s lists %s, a %s, under transformers", path, transformer, kind)
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// pluginKinds returns the qlik.com/v1 kinds configured in path, a file or
+// the resources of a kustomization
+func pluginKinds(t *testing.T, path string) []string {
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if info.IsDir() {
+		content, err := ioutil.ReadFile(filepath.Join(path, kustomizationFile))
+		require.NoError(t, err)
+		var k types.Kustomization
+		require.NoError(t, yaml.Unmarshal(content, &k), path)
+		var kinds []string
+		for _, resource := range k.Resources {
+			if _, err := git.NewRepoSpecFromUrl(resource); err == nil {
+				continue
+			}
+			kinds = append(kinds, pluginKinds(t, filepath.Join(path, strings.TrimSpace(resource)))...)
+		}
+		return kinds
+	}
+	objects, err := diff.ReadPath(path)
+	require.NoError(t, err)
+	var kinds []string
+	for _, object := range objects {
+		if object["apiVersion"] == plugins.APIVersion {
+			kinds = append(kinds, object["kind"].(string))
+		}
+	}
+	return kinds
+}
+
+func newPlugin(t *testing.T, kind string) plugins.Plugin {
+	plugin, err := plugins.New(kind)
+	require.NoError(t, err)
+	return plugin
+}
@@ -0,0 +1,123 @@
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kustomize/v3/pkg/git"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Dependencies returns the components each component of the profile depends
+// on, in the order of the profile. A component depends on another when its
+// kustomizations load files from a directory of that component in any
+// profile, as the components do with the transformers of qliksense. Paths
+// in the configs of plugins are not followed.
+func Dependencies(configs string, profile string) (map[string][]string, error) {
+	components, err := Components(configs, profile)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(configs)
+	if err != nil {
+		return nil, err
+	}
+	dependencies := map[string][]string{}
+	for _, component := range components {
+		w := walker{root: root, visited: map[string]bool{}, loaded: map[string]bool{}}
+		dir, err := filepath.Abs(filepath.Join(configs, profile, component))
+		if err != nil {
+			return nil, err
+		}
+		if err := w.walk(dir); err != nil {
+			return nil, err
+		}
+		dependencies[component] = []string{}
+		for _, other := range components {
+			if other != component && w.loaded[other] {
+				dependencies[component] = append(dependencies[component], other)
+			}
+		}
+	}
+	return dependencies, nil
+}
+
+// walker follows the kustomizations under root and records the names of the
+// component directories, <root>/<profile>/<component>, it loads from.
+type walker struct {
+	root    string
+	visited map[string]bool
+	loaded  map[string]bool
+}
+
+func (w *walker) walk(dir string) error {
+	if w.visited[dir] {
+		return nil
+	}
+	w.visited[dir] = true
+	w.record(dir)
+	content, err := ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	if err != nil {
+		return err
+	}
+	var k types.Kustomization
+	if err := yaml.Unmarshal(content, &k); err != nil {
+		return fmt.Errorf("%s: %v", filepath.Join(dir, kustomizationFile), err)
+	}
+
+	paths := append([]string{}, k.Resources...)
+	paths = append(paths, k.Bases...)
+	paths = append(paths, k.Generators...)
+	paths = append(paths, k.Transformers...)
+	paths = append(paths, k.Crds...)
+	paths = append(paths, k.Configurations...)
+	for _, patch := range k.PatchesStrategicMerge {
+		// inline patches hold a document rather than a path
+		if !strings.Contains(string(patch), "\n") {
+			paths = append(paths, string(patch))
+		}
+	}
+	for _, patch := range k.PatchesJson6902 {
+		paths = append(paths, patch.Path)
+	}
+	for _, patch := range k.Patches {
+		paths = append(paths, patch.Path)
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := git.NewRepoSpecFromUrl(path); err == nil {
+			continue
+		}
+		path = filepath.Join(dir, path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			w.record(path)
+			continue
+		}
+		if err := w.walk(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) record(path string) {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) >= 2 && parts[0] != ".." {
+		w.loaded[parts[1]] = true
+	}
+}
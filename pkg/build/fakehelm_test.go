@@ -0,0 +1,221 @@
+package build
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/qlik-trial/qliksense-config/pkg/values"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeHelm stands in for helm in the golden tests, the test binary runs as
+// helm when it is called by that name. Charts are rendered with
+// text/template and the few template functions the charts here use, so no
+// helm has to be installed and no chart repository is ever reached.
+func fakeHelm(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("no command")
+	}
+	switch args[0] {
+	case "init":
+		return nil
+	case "template":
+		return fakeTemplate(args[1:], out)
+	default:
+		return fmt.Errorf("%s is not supported, charts must be local fixtures", args[0])
+	}
+}
+
+func fakeTemplate(args []string, out io.Writer) error {
+	var chartDir, release, namespace string
+	var valuesFiles []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--home="):
+		case strings.HasPrefix(arg, "--values="):
+			valuesFiles = append(valuesFiles, strings.TrimPrefix(arg, "--values="))
+		case strings.HasPrefix(arg, "--name="):
+			release = strings.TrimPrefix(arg, "--name=")
+		case strings.HasPrefix(arg, "--namespace="):
+			namespace = strings.TrimPrefix(arg, "--namespace=")
+		case strings.HasPrefix(arg, "-") || chartDir != "":
+			return fmt.Errorf("template %s is not supported", arg)
+		default:
+			chartDir = arg
+		}
+	}
+	if chartDir == "" {
+		return errors.New("template needs a chart")
+	}
+	rendered, err := renderChart(chartDir, valuesFiles, release, namespace)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(rendered)
+	return err
+}
+
+// renderChart renders the templates of the chart in order, as helm template
+// does, with the values of the chart merged with the values files
+func renderChart(chartDir string, valuesFiles []string, release string, namespace string) ([]byte, error) {
+	var metadata map[string]interface{}
+	if err := readYAML(filepath.Join(chartDir, "Chart.yaml"), &metadata); err != nil {
+		return nil, err
+	}
+	chartValues := map[string]interface{}{}
+	if _, err := os.Stat(filepath.Join(chartDir, "values.yaml")); err == nil {
+		if err := readYAML(filepath.Join(chartDir, "values.yaml"), &chartValues); err != nil {
+			return nil, err
+		}
+	}
+	for _, valuesFile := range valuesFiles {
+		var fileValues map[string]interface{}
+		if err := readYAML(valuesFile, &fileValues); err != nil {
+			return nil, err
+		}
+		chartValues = values.Merge(chartValues, fileValues)
+	}
+	data := map[string]interface{}{
+		"Values": chartValues,
+		"Release": map[string]interface{}{
+			"Name":      release,
+			"Namespace": namespace,
+			"Service":   "Tiller",
+		},
+		"Chart": map[string]interface{}{
+			"Name":       metadata["name"],
+			"Version":    metadata["version"],
+			"AppVersion": metadata["appVersion"],
+		},
+	}
+
+	var names []string
+	templatesDir := filepath.Join(chartDir, "templates")
+	err := filepath.Walk(templatesDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			names = append(names, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	root := template.New(fmt.Sprint(metadata["name"])).Option("missingkey=zero")
+	root.Funcs(templateFuncs(root))
+	for _, path := range names {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(chartDir, path)
+		if _, err := root.New(filepath.ToSlash(rel)).Parse(string(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	for _, path := range names {
+		rel, _ := filepath.Rel(chartDir, path)
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(filepath.Base(rel), "_") || filepath.Base(rel) == "NOTES.txt" {
+			continue
+		}
+		var b bytes.Buffer
+		if err := root.ExecuteTemplate(&b, rel, data); err != nil {
+			return nil, err
+		}
+		rendered := strings.TrimSpace(strings.Replace(b.String(), "<no value>", "", -1))
+		if rendered == "" {
+			continue
+		}
+		fmt.Fprintf(&out, "---\n# Source: %s/%s\n%s\n", metadata["name"], rel, rendered)
+	}
+	return out.Bytes(), nil
+}
+
+// templateFuncs are the functions of helm and sprig the charts use
+func templateFuncs(root *template.Template) template.FuncMap {
+	return template.FuncMap{
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"default": func(d interface{}, given ...interface{}) interface{} {
+			if len(given) == 0 || isEmpty(given[0]) {
+				return d
+			}
+			return given[0]
+		},
+		"include": func(name string, data interface{}) (string, error) {
+			var b bytes.Buffer
+			err := root.ExecuteTemplate(&b, name, data)
+			return b.String(), err
+		},
+		"indent": func(spaces int, s string) string {
+			pad := strings.Repeat(" ", spaces)
+			return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+		},
+		"quote": func(in ...interface{}) string {
+			var quoted []string
+			for _, s := range in {
+				if s != nil {
+					quoted = append(quoted, fmt.Sprintf("%q", fmt.Sprint(s)))
+				}
+			}
+			return strings.Join(quoted, " ")
+		},
+		"toYaml": func(v interface{}) (string, error) {
+			b, err := yaml.Marshal(v)
+			return strings.TrimSuffix(string(b), "\n"), err
+		},
+		"tpl": func(text string, data interface{}) (string, error) {
+			// root can no longer be cloned once it runs, so named templates
+			// are only reached through include
+			t, err := template.New("tpl").Option("missingkey=zero").Funcs(templateFuncs(root)).Parse(text)
+			if err != nil {
+				return "", err
+			}
+			var b bytes.Buffer
+			err = t.Execute(&b, data)
+			return strings.Replace(b.String(), "<no value>", "", -1), err
+		},
+	}
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return value.Interface() == reflect.Zero(value.Type()).Interface()
+	}
+	return false
+}
+
+func readYAML(path string, out interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package build
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/qlik-trial/qliksense-config/pkg/command"
+	"github.com/qlik-trial/qliksense-config/pkg/diff"
+	"github.com/qlik-trial/qliksense-config/pkg/fsutil"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "write the renders to the golden files under testdata/golden")
+
+// repoRoot is the root of this repo, relative to this package
+const repoRoot = "../.."
+
+// remoteBase matches the remote bases of the configs, the repo and the
+// path in it
+var remoteBase = regexp.MustCompile(`github\.com/qlik-oss/([\w.-]+?)//([\w./-]+)`)
+
+func TestMain(m *testing.M) {
+	PluginMain()
+	if filepath.Base(os.Args[0]) == "helm" {
+		if err := fakeHelm(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "helm: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if filepath.Base(os.Args[0]) == "kustomize" {
+		if err := fakeKustomize(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "kustomize: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeKustomize stands in for kustomize build, as HelmChart runs it on its
+// chartPatches, with Build
+func fakeKustomize(args []string, out io.Writer) error {
+	if len(args) != 2 || args[0] != "build" {
+		return fmt.Errorf("%v is not supported", args)
+	}
+	m, err := Build(args[1], Options{})
+	if err != nil {
+		return err
+	}
+	rendered, err := m.AsYaml()
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(rendered)
+	return err
+}
+
+// TestGolden renders every profile and each of its components and compares
+// them with the golden files. Remote bases are served from fixture repos and
+// charts are rendered by the fake helm, so no network is used. Run
+//
+//	go test ./build -run TestGolden -update
+//
+// to write the golden files after an intended change.
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("renders every profile")
+	}
+	dir, err := ioutil.TempDir("", "golden")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer setenv(t, "PATH", fakeBinDir(t, dir)+string(os.PathListSeparator)+os.Getenv("PATH"))()
+	for key, value := range serveRemotes(t, dir) {
+		defer setenv(t, key, value)()
+	}
+
+	configs := filepath.Join(repoRoot, DefaultConfigs)
+	profiles, err := Profiles(configs)
+	require.NoError(t, err)
+	rendered := map[string]bool{}
+	// the group returns once its parallel renders are done
+	t.Run("render", func(t *testing.T) {
+		for _, profile := range profiles {
+			profile := profile
+			components, err := Components(configs, profile)
+			require.NoError(t, err)
+			rendered[goldenFile(profile, "")] = true
+			t.Run(profile, func(t *testing.T) {
+				t.Parallel()
+				checkGolden(t, configs, profile, "")
+			})
+			for _, component := range components {
+				component := component
+				rendered[goldenFile(profile, component)] = true
+				t.Run(profile+"/"+component, func(t *testing.T) {
+					t.Parallel()
+					checkGolden(t, configs, profile, component)
+				})
+			}
+		}
+	})
+
+	// golden files of profiles and components that are gone
+	for _, golden := range goldenFiles(t) {
+		if rendered[golden] {
+			continue
+		}
+		if *update {
+			require.NoError(t, os.Remove(golden))
+		} else {
+			t.Errorf("%s is not rendered anymore, run go test ./build -run TestGolden -update", golden)
+		}
+	}
+}
+
+// goldenFile is testdata/golden/<profile>.yaml or
+// testdata/golden/<profile>/<component>.yaml
+func goldenFile(profile string, component string) string {
+	return filepath.Join("testdata", "golden", filepath.Join(profile, component)+".yaml")
+}
+
+// checkGolden renders the profile or component and compares it with its
+// golden file
+func checkGolden(t *testing.T, configs string, profile string, component string) {
+	name := filepath.Join(profile, component)
+	golden := goldenFile(profile, component)
+
+	// as qliksense-config builds them by default, the components load the
+	// transformers of qliksense
+	m, err := Build(filepath.Join(configs, name), Options{LoadRestrictor: "none"})
+	require.NoError(t, err)
+	got, err := m.AsYaml()
+	require.NoError(t, err)
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0755))
+		require.NoError(t, ioutil.WriteFile(golden, got, 0644))
+		return
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if os.IsNotExist(err) {
+		t.Fatalf("%s is missing, run go test ./build -run TestGolden -update", golden)
+	}
+	require.NoError(t, err)
+	if bytes.Equal(want, got) {
+		return
+	}
+	wantObjects, err := diff.Read(bytes.NewReader(want))
+	require.NoError(t, err)
+	gotObjects, err := diff.Read(bytes.NewReader(got))
+	require.NoError(t, err)
+	changes, err := diff.Compare(wantObjects, gotObjects, diff.Options{})
+	require.NoError(t, err)
+	var b bytes.Buffer
+	require.NoError(t, diff.Format(&b, changes))
+	if b.Len() == 0 {
+		b.WriteString("the resources are the same in another order\n")
+	}
+	t.Errorf("%s renders differently than %s, run go test ./build -run TestGolden -update if that is intended:\n%s", name, golden, b.String())
+}
+
+// fakeBinDir links the test binary as helm and kustomize in a directory to
+// put on PATH
+func fakeBinDir(t *testing.T, dir string) string {
+	bin := filepath.Join(dir, "bin")
+	require.NoError(t, os.MkdirAll(bin, 0755))
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	for _, name := range []string{"helm", "kustomize"} {
+		require.NoError(t, os.Symlink(executable, filepath.Join(bin, name)))
+	}
+	return bin
+}
+
+// serveRemotes creates a fixture repo for every remote base of the configs
+// and generators and returns the environment that makes git fetch them
+// instead of github.com. The base holds a HelmChart of the chart named
+// after the repo, testdata/charts/<chart> or testdata/charts/default.
+func serveRemotes(t *testing.T, dir string) map[string]string {
+	remotes := filepath.Join(dir, "remotes")
+	bases := map[string][]string{}
+	for _, root := range []string{"configs", "generators"} {
+		err := filepath.Walk(filepath.Join(repoRoot, root), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".yaml" {
+				return err
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, match := range remoteBase.FindAllStringSubmatch(string(content), -1) {
+				bases[match[1]] = append(bases[match[1]], match[2])
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	for repo, paths := range bases {
+		repoDir := filepath.Join(remotes, repo+".git")
+		chart := strings.TrimSuffix(strings.TrimSuffix(repo, "-app"), "-resources")
+		for _, path := range paths {
+			writeBase(t, filepath.Join(repoDir, path), chart)
+		}
+		commitRepo(t, repoDir)
+	}
+	return remotesEnv(remotes)
+}
+
+// remotesEnv returns the environment that makes git fetch the repos of
+// github.com/qlik-oss from <remotes>/<repo>.git
+func remotesEnv(remotes string) map[string]string {
+	return map[string]string{
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_CONFIG_GLOBAL":   os.DevNull,
+		"GIT_CONFIG_COUNT":    "1",
+		"GIT_CONFIG_KEY_0":    "url.file://" + filepath.ToSlash(remotes) + "/.insteadOf",
+		"GIT_CONFIG_VALUE_0":  "https://github.com/qlik-oss/",
+	}
+}
+
+// commitRepo makes the files in dir the master branch of a repo
+func commitRepo(t *testing.T, dir string) {
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/master"},
+		{"add", "-A"},
+		{"-c", "user.name=golden", "-c", "user.email=golden@example.com", "commit", "-q", "-m", "fixture"},
+	} {
+		_, err := command.Run(dir, "git", args...)
+		require.NoError(t, err)
+	}
+}
+
+// writeBase writes a base of a HelmChart and a ChartHomeFullPath that stages
+// its chart, as the generators of the component repos are
+func writeBase(t *testing.T, dir string, chart string) {
+	fixture := filepath.Join("testdata", "charts", chart)
+	if _, err := os.Stat(fixture); os.IsNotExist(err) {
+		fixture = filepath.Join("testdata", "charts", "default")
+	}
+	require.NoError(t, fsutil.CopyDir(fixture, filepath.Join(dir, "chart")))
+	writeFiles(t, dir, map[string]string{
+		"kustomization.yaml": `
+resources:
+- helmchart.yaml
+transformers:
+- charthome.yaml
+`,
+		"helmchart.yaml": fmt.Sprintf(`
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: %[1]s
+chartName: %[1]s
+releaseName: %[1]s
+`, chart),
+		"charthome.yaml": fmt.Sprintf(`
+apiVersion: qlik.com/v1
+kind: ChartHomeFullPath
+metadata:
+  name: %s
+chartHome: chart
+`, chart),
+		"chart/Chart.yaml": fmt.Sprintf("apiVersion: v1\nname: %s\nversion: 0.0.1\n", chart),
+	})
+}
+
+// setenv sets an environment variable and returns a function restoring it
+func setenv(t *testing.T, key string, value string) func() {
+	old, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestFakeHelm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakehelm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"chart/Chart.yaml":             "name: engine\nversion: 1.2.3\n",
+		"chart/values.yaml":            "replicas: 1\nimage: engine\n",
+		"chart/templates/_helpers.tpl": `{{- define "engine.name" -}}{{ .Release.Name }}-{{ .Chart.Name }}{{- end -}}`,
+		"chart/templates/empty.yaml":   "{{- if .Values.missing }}kind: Secret{{ end }}\n",
+		"chart/templates/deployment.yaml": `
+kind: Deployment
+metadata:
+  name: {{ include "engine.name" . }}
+  annotations:
+    owner: {{ tpl .Values.owner . | quote }}
+    secret: {{ .Values.secret | b64enc }}
+spec:
+  replicas: {{ .Values.replicas }}
+  image: {{ default "engine" .Values.image.repository }}:{{ .Chart.Version }}
+{{ toYaml .Values.extra | indent 2 }}
+`,
+		"values.yaml": "replicas: 3\nimage:\n  repository: qlik/engine\nowner: '{{ .Release.Namespace }}'\nsecret: s\nextra:\n  a: b\n",
+	})
+
+	var out bytes.Buffer
+	require.NoError(t, fakeHelm([]string{
+		"template", "--home=/helm", "--values=" + filepath.Join(dir, "values.yaml"),
+		"--name=qliksense", "--namespace=qlik", filepath.Join(dir, "chart"),
+	}, &out))
+	require.Equal(t, `---
+# Source: engine/templates/deployment.yaml
+kind: Deployment
+metadata:
+  name: qliksense-engine
+  annotations:
+    owner: "qlik"
+    secret: cw==
+spec:
+  replicas: 3
+  image: qlik/engine:1.2.3
+  a: b
+`, out.String())
+
+	require.EqualError(t, fakeHelm([]string{"fetch", "engine"}, &out), "fetch is not supported, charts must be local fixtures")
+	require.EqualError(t, fakeHelm([]string{"template", "--set=a=b", "chart"}, &out), "template --set=a=b is not supported")
+}
+
+// goldenFiles returns the golden files, so that stale ones can be found
+func goldenFiles(t *testing.T) []string {
+	var files []string
+	err := filepath.Walk(filepath.Join("testdata", "golden"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if !os.IsNotExist(err) {
+		require.NoError(t, err)
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,64 @@
+// Command qlik-plugins runs the qlik.com/v1 kustomize plugins as one binary.
+//
+// Without arguments it is a KRM function, reading a ResourceList on stdin
+// and writing it to stdout, as kpt and kustomize fn run it. With the path
+// of a plugin config as its first argument it is a kustomize exec plugin,
+// installed under each kind's name in the kustomize plugin directory.
+//
+// The plugins load files as kustomize's --load_restrictor none does, the
+// components of the configs load the transformers of qliksense from outside
+// their root. QLIK_PLUGINS_LOAD_RESTRICTOR=rootOnly restricts them to it.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/qlik-trial/qliksense-config/pkg/function"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins"
+)
+
+// loadRestrictorEnv names the load restrictor of the plugins, none when unset
+const loadRestrictorEnv = "QLIK_PLUGINS_LOAD_RESTRICTOR"
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "qlik-plugins: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// kustomize names the root of the kustomization the config comes from
+	if configRoot := os.Getenv("KUSTOMIZE_PLUGIN_CONFIG_ROOT"); configRoot != "" {
+		root = configRoot
+	}
+	restrictor := os.Getenv(loadRestrictorEnv)
+	if restrictor == "" {
+		restrictor = "none"
+	}
+	lr, err := plugins.LoadRestrictor(restrictor)
+	if err != nil {
+		return fmt.Errorf("%s: %v", loadRestrictorEnv, err)
+	}
+	ldr, err := plugins.NewLoader(lr, root)
+	if err != nil {
+		return err
+	}
+	defer ldr.Cleanup()
+
+	if len(args) == 0 {
+		return function.RunResourceList(in, out, ldr)
+	}
+	config, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	return function.RunExec(config, in, out, ldr)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunExecComponent runs the shared SelectivePatch of qliksense as
+// kustomize runs it for chronos, it loads its patch from outside of the
+// root of chronos.
+func TestRunExecComponent(t *testing.T) {
+	configs, err := filepath.Abs(filepath.Join("..", "..", "..", "configs", "qseok"))
+	require.NoError(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(configs, "qliksense", "transformers", "mongodb.yaml"))
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "qlik-plugins")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// as a component enabling it would
+	config := filepath.Join(dir, "mongodb.yaml")
+	require.NoError(t, ioutil.WriteFile(config, bytes.Replace(content, []byte("enabled: false"), []byte("enabled: true"), 1), 0644))
+	defer setenv(t, "KUSTOMIZE_PLUGIN_CONFIG_ROOT", filepath.Join(configs, "chronos"))()
+
+	in := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: chronos
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: chronos
+`
+	var out bytes.Buffer
+	require.NoError(t, run([]string{config}, strings.NewReader(in), &out))
+	require.Equal(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: chronos
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: MONGO_URI
+          valueFrom:
+            secretKeyRef:
+              key: mongodb-uri
+              name: qliksense-mongoconfig
+        image: chronos
+        name: main
+`, out.String())
+
+	defer setenv(t, loadRestrictorEnv, "rootOnly")()
+	err = run([]string{config}, strings.NewReader(in), &out)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not in or below")
+}
+
+func setenv(t *testing.T, key string, value string) func() {
+	old, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
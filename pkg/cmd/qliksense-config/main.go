@@ -0,0 +1,352 @@
+// Command qliksense-config builds, diffs and applies the profiles under
+// configs and their components, with the qlik.com/v1 plugins linked in so
+// that none have to be installed for kustomize.
+//
+//	qliksense-config build [flags] <profile> [component]
+//	qliksense-config diff [flags] --against <file or directory> <profile> [component]
+//	qliksense-config apply [flags] <profile> [component] [-- kubectl flags]
+//	qliksense-config argocd [flags] <profile>
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/argocd"
+	"github.com/qlik-trial/qliksense-config/pkg/build"
+	"github.com/qlik-trial/qliksense-config/pkg/diff"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/yaml"
+)
+
+// componentLabel is the label kubectl apply --prune selects a component by
+const componentLabel = "app"
+
+// errDifferences is returned by diff when there are differences
+var errDifferences = errors.New("differences found")
+
+const usage = `Usage:
+  qliksense-config build [flags] <profile> [component]
+  qliksense-config diff [flags] --against <file or directory> <profile> [component]
+  qliksense-config apply [flags] <profile> [component] [-- kubectl flags]
+  qliksense-config argocd [flags] <profile>
+
+diff exits with 1 when there are differences and with 2 on errors.
+`
+
+func main() {
+	build.PluginMain()
+	err := run(os.Args[1:], os.Stdout)
+	if err == errDifferences {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "qliksense-config: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("no command")
+	}
+	switch args[0] {
+	case "build":
+		return buildCommand(args[1:], out)
+	case "diff":
+		return diffCommand(args[1:], out)
+	case "apply":
+		return applyCommand(args[1:], out)
+	case "argocd":
+		return argocdCommand(args[1:], out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// target is the profile or component a command works on
+type target struct {
+	configs   string
+	options   build.Options
+	profile   string
+	component string
+}
+
+func (t *target) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&t.configs, "configs", build.DefaultConfigs, "directory of the profiles")
+	// kustomize defaults to rootOnly, but the components of the profiles load
+	// patches of the qliksense component, ../qliksense/transformers, and fail
+	// to build with it
+	flags.StringVar(&t.options.LoadRestrictor, "load_restrictor", "none",
+		"rootOnly or none, with none kustomizations may load files from outside their root")
+}
+
+// parse takes the profile and the optional component from args and returns
+// the rest
+func (t *target) parse(args []string) ([]string, error) {
+	if len(args) == 0 || args[0] == "--" {
+		return nil, errors.New("no profile")
+	}
+	t.profile, args = args[0], args[1:]
+	if len(args) > 0 && args[0] != "--" {
+		t.component, args = args[0], args[1:]
+	}
+	return args, nil
+}
+
+func (t *target) build() (resmap.ResMap, error) {
+	path, err := build.Path(t.configs, t.profile, t.component)
+	if err != nil {
+		return nil, err
+	}
+	return build.Build(path, t.options)
+}
+
+func buildCommand(args []string, out io.Writer) error {
+	var t target
+	var outputDir string
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	t.addFlags(flags)
+	flags.StringVar(&outputDir, "output-dir", "",
+		"write the resources of each component to <component>.yaml in this directory, by their app label")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	rest, err := t.parse(flags.Args())
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %v", rest)
+	}
+
+	m, err := t.build()
+	if err != nil {
+		return err
+	}
+	if outputDir == "" {
+		yaml, err := m.AsYaml()
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(yaml)
+		return err
+	}
+	return writeComponents(outputDir, t.profile, m)
+}
+
+// writeComponents writes the resources labelled with a component to
+// <component>.yaml and unlabelled ones to <profile>.yaml. Files of other
+// components already in dir are left.
+func writeComponents(dir string, profile string, m resmap.ResMap) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var names []string
+	components := map[string]*bytes.Buffer{}
+	for _, r := range m.Resources() {
+		name := r.GetLabels()[componentLabel]
+		if name == "" {
+			name = profile
+		}
+		if components[name] == nil {
+			names = append(names, name)
+			components[name] = &bytes.Buffer{}
+		}
+		yaml, err := r.AsYAML()
+		if err != nil {
+			return err
+		}
+		b := components[name]
+		if b.Len() > 0 {
+			b.WriteString("---\n")
+		}
+		b.Write(yaml)
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".yaml"), components[name].Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffCommand(args []string, out io.Writer) error {
+	var t target
+	var against string
+	var options diff.Options
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	t.addFlags(flags)
+	flags.StringVar(&against, "against", "",
+		"previous render, a file or a build --output-dir directory, or a cluster snapshot from kubectl get -o yaml")
+	flags.BoolVar(&options.IgnoreExtraFields, "ignore-extra-fields", false,
+		"ignore fields only the resources diffed against have, such as defaults of the cluster")
+	flags.StringVar(&options.Namespace, "namespace", "",
+		"namespace of the rendered resources without one, the namespace of the profile when not set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	rest, err := t.parse(flags.Args())
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %v", rest)
+	}
+	if against == "" {
+		return errors.New("--against is not set")
+	}
+
+	old, err := diff.ReadPath(against)
+	if err != nil {
+		return err
+	}
+	if t.component != "" {
+		old = withComponent(old, t.component)
+	}
+	m, err := t.build()
+	if err != nil {
+		return err
+	}
+	if options.Namespace == "" {
+		if options.Namespace, err = build.Namespace(t.configs, t.profile); err != nil {
+			return err
+		}
+	}
+	var new []diff.Object
+	for _, r := range m.Resources() {
+		new = append(new, r.Map())
+	}
+
+	changes, err := diff.Compare(old, new, options)
+	if err != nil {
+		return err
+	}
+	if err := diff.Format(out, changes); err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return errDifferences
+	}
+	return nil
+}
+
+// withComponent returns the objects of the component, as kubectl apply
+// --prune -l app=<component> selects them
+func withComponent(objects []diff.Object, component string) []diff.Object {
+	var result []diff.Object
+	for _, object := range objects {
+		metadata, _ := object["metadata"].(map[string]interface{})
+		labels, _ := metadata["labels"].(map[string]interface{})
+		if labels[componentLabel] == component {
+			result = append(result, object)
+		}
+	}
+	return result
+}
+
+func applyCommand(args []string, out io.Writer) error {
+	var t target
+	var kubectl string
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	t.addFlags(flags)
+	flags.StringVar(&kubectl, "kubectl", "kubectl", "kubectl binary")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	rest, err := t.parse(flags.Args())
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	} else if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %v, kubectl flags follow --", rest)
+	}
+
+	m, err := t.build()
+	if err != nil {
+		return err
+	}
+	yaml, err := m.AsYaml()
+	if err != nil {
+		return err
+	}
+	kubectlArgs := []string{"apply", "-f", "-"}
+	if t.component != "" {
+		// a single component prunes what it no longer renders
+		kubectlArgs = append(kubectlArgs, "--prune", "-l", componentLabel+"="+t.component)
+	}
+	cmd := exec.Command(kubectl, append(kubectlArgs, rest...)...)
+	cmd.Stdin = bytes.NewReader(yaml)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func argocdCommand(args []string, out io.Writer) error {
+	var configs string
+	var prerequisites string
+	var syncScript bool
+	options := argocd.DefaultOptions
+	flags := flag.NewFlagSet("argocd", flag.ContinueOnError)
+	flags.StringVar(&configs, "configs", build.DefaultConfigs, "directory of the profiles")
+	flags.StringVar(&options.RepoURL, "repo", options.RepoURL, "repo the Applications deploy from")
+	flags.StringVar(&options.Revision, "revision", options.Revision, "branch, tag or commit of the repo, its HEAD when not set")
+	flags.StringVar(&options.Path, "path", options.Path, "directory of the profiles in the repo")
+	flags.StringVar(&options.Namespace, "namespace", options.Namespace, "namespace of ArgoCD the Applications are created in")
+	flags.StringVar(&options.Project, "project", options.Project, "ArgoCD project of the Applications")
+	flags.StringVar(&options.Server, "server", options.Server, "API server of the cluster the components are deployed to")
+	flags.StringVar(&options.DestinationNamespace, "dest-namespace", options.DestinationNamespace, "namespace the components are deployed to")
+	flags.BoolVar(&options.Automated, "automated", options.Automated, "sync the Applications whenever the repo changes")
+	flags.BoolVar(&options.Prune, "prune", options.Prune, "delete what a component no longer renders on automated syncs")
+	flags.BoolVar(&options.SelfHeal, "self-heal", options.SelfHeal, "revert changes made in the cluster on automated syncs")
+	flags.StringVar(&prerequisites, "prerequisites", strings.Join(options.Prerequisites, ","),
+		"comma separated directories of the repo outside of the profiles, deployed before the components")
+	flags.BoolVar(&syncScript, "sync-script", false, "write a script syncing the Applications wave by wave instead")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected a profile")
+	}
+	profile := flags.Arg(0)
+	options.Prerequisites = nil
+	if prerequisites != "" {
+		options.Prerequisites = strings.Split(prerequisites, ",")
+	}
+	if _, err := build.Path(configs, profile, ""); err != nil {
+		return err
+	}
+
+	applications, err := argocd.Applications(configs, profile, options)
+	if err != nil {
+		return err
+	}
+	if syncScript {
+		fmt.Fprintf(out, "#!/bin/bash\n# generated by qliksense-config argocd --sync-script %s\n\nset -e\n", profile)
+		for _, a := range argocd.SyncOrder(applications) {
+			fmt.Fprintf(out, "argocd app sync %s\n", a.Metadata.Name)
+		}
+		return nil
+	}
+	list, err := yaml.Marshal(argocd.NewList(applications))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(list)
+	return err
+}
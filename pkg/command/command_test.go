@@ -0,0 +1,24 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	out, err := Run("/", "sh", "-c", "pwd")
+	require.NoError(t, err)
+	require.Equal(t, "/\n", string(out))
+
+	_, err = Run("", "sh", "-c", "echo chart not found >&2; exit 3")
+	require.Error(t, err)
+	cmdErr, ok := err.(*Error)
+	require.True(t, ok)
+	require.Equal(t, "sh", cmdErr.Name)
+	require.Equal(t, "chart not found\n", cmdErr.Stderr)
+	require.Contains(t, err.Error(), "exit status 3: chart not found")
+
+	_, err = Run("", "qliksense-missing-binary")
+	require.Error(t, err)
+}
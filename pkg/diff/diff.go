@@ -0,0 +1,467 @@
+// Package diff compares rendered resources with a previous render or a
+// snapshot of a cluster, resource by resource and field by field.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Change types
+const (
+	Added   = "+"
+	Removed = "-"
+	Changed = "~"
+)
+
+// Object is a resource as decoded from YAML or JSON.
+type Object = map[string]interface{}
+
+// Change is a resource that was added, removed or changed.
+type Change struct {
+	Type       string
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Fields are the changed fields of a changed resource
+	Fields []Field
+}
+
+// Field is a changed field, Old or New is nil if the field was added or
+// removed.
+type Field struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// Options change what is compared.
+type Options struct {
+	// IgnoreExtraFields ignores fields that only the old resources have, such
+	// as the defaults an API server fills in
+	IgnoreExtraFields bool
+	// Namespace is the namespace new resources without one are deployed to,
+	// they are compared with the old resources in it
+	Namespace string
+}
+
+// serverFields are set by the API server and never rendered
+var serverFields = [][]string{
+	{"status"},
+	{"metadata", "uid"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "selfLink"},
+	{"metadata", "managedFields"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+	{"metadata", "annotations", "deployment.kubernetes.io/revision"},
+}
+
+// movedGroups are the groups of the kinds that moved out of extensions, a
+// cluster returns them in the new group whatever they were applied with
+var movedGroups = map[string]string{
+	"DaemonSet":         "apps",
+	"Deployment":        "apps",
+	"ReplicaSet":        "apps",
+	"Ingress":           "networking.k8s.io",
+	"NetworkPolicy":     "networking.k8s.io",
+	"PodSecurityPolicy": "policy",
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// Read reads the resources of a YAML stream, kind List documents, such as
+// kubectl get -o yaml writes, are read as their items.
+func Read(in io.Reader) ([]Object, error) {
+	content, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, document := range documentSeparator.Split(string(content), -1) {
+		var object Object
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			return nil, err
+		}
+		if object == nil {
+			continue
+		}
+		kind, _ := object["kind"].(string)
+		if items, ok := object["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+			for _, item := range items {
+				if itemObject, ok := item.(Object); ok {
+					objects = append(objects, itemObject)
+				}
+			}
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// ReadPath reads the resources of a file or of the .yaml, .yml and .json
+// files of a directory.
+func ReadPath(path string) ([]Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{path}
+	if info.IsDir() {
+		paths = nil
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					paths = append(paths, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	}
+	var objects []Object
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		read, err := Read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		objects = append(objects, read...)
+	}
+	return objects, nil
+}
+
+// Compare returns the changes from old to new ordered by resource. Resources
+// are matched by group, kind, namespace and name, whatever the version of
+// their apiVersion, so that a render and a snapshot of a cluster that serves
+// them under another version compare.
+func Compare(old []Object, new []Object, options Options) ([]Change, error) {
+	oldByKey, err := byKey(old)
+	if err != nil {
+		return nil, err
+	}
+	if options.Namespace != "" {
+		new = withNamespace(new, options.Namespace, oldByKey)
+	}
+	newByKey, err := byKey(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for key, newObject := range newByKey {
+		oldObject, ok := oldByKey[key]
+		if !ok {
+			changes = append(changes, newChange(Added, newObject))
+			continue
+		}
+		var fields []Field
+		compare(nil, withoutAPIVersion(oldObject), withoutAPIVersion(newObject), options, &fields)
+		if len(fields) > 0 {
+			change := newChange(Changed, newObject)
+			change.Fields = fields
+			changes = append(changes, change)
+		}
+	}
+	for key, oldObject := range oldByKey {
+		if _, ok := newByKey[key]; !ok {
+			changes = append(changes, newChange(Removed, oldObject))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID() < changes[j].ID()
+	})
+	return changes, nil
+}
+
+// ID identifies the resource of the change.
+func (c Change) ID() string {
+	name := c.Name
+	if c.Namespace != "" {
+		name = c.Namespace + "/" + name
+	}
+	return c.APIVersion + " " + c.Kind + " " + name
+}
+
+// Format writes the changes as a list of resources, each followed by its
+// changed fields. Values of Secrets are not written.
+func Format(out io.Writer, changes []Change) error {
+	var b bytes.Buffer
+	for _, change := range changes {
+		fmt.Fprintf(&b, "%s %s\n", change.Type, change.ID())
+		for _, field := range change.Fields {
+			if change.Kind == "Secret" && isSecretValue(field.Path) {
+				fmt.Fprintf(&b, "    %s: <secret value changed>\n", field.Path)
+				continue
+			}
+			fmt.Fprintf(&b, "    %s: %s -> %s\n", field.Path, formatValue(field.Old), formatValue(field.New))
+		}
+	}
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+func isSecretValue(path string) bool {
+	for _, prefix := range []string{"data", "stringData"} {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+func newChange(changeType string, object Object) Change {
+	metadata, _ := object["metadata"].(Object)
+	change := Change{Type: changeType}
+	change.APIVersion, _ = object["apiVersion"].(string)
+	change.Kind, _ = object["kind"].(string)
+	change.Namespace, _ = metadata["namespace"].(string)
+	change.Name, _ = metadata["name"].(string)
+	return change
+}
+
+// byKey normalizes the objects and indexes them by resource
+func byKey(objects []Object) (map[string]Object, error) {
+	result := make(map[string]Object, len(objects))
+	for _, object := range objects {
+		normalized, err := normalize(object)
+		if err != nil {
+			return nil, err
+		}
+		k := key(normalized)
+		if _, ok := result[k]; ok {
+			return nil, fmt.Errorf("duplicate resource %s", newChange("", normalized).ID())
+		}
+		result[k] = normalized
+	}
+	return result, nil
+}
+
+// key identifies the resource of the object by group, kind, namespace and
+// name
+func key(object Object) string {
+	change := newChange("", object)
+	group := ""
+	if i := strings.Index(change.APIVersion, "/"); i >= 0 {
+		group = change.APIVersion[:i]
+	}
+	if moved, ok := movedGroups[change.Kind]; ok && group == "extensions" {
+		group = moved
+	}
+	return strings.Join([]string{group, change.Kind, change.Namespace, change.Name}, " ")
+}
+
+// withNamespace returns the objects with the namespace set on those without
+// one that old has in it, cluster scoped resources are left without
+func withNamespace(objects []Object, namespace string, old map[string]Object) []Object {
+	result := make([]Object, 0, len(objects))
+	for _, object := range objects {
+		metadata, _ := object["metadata"].(Object)
+		if ns, _ := metadata["namespace"].(string); ns != "" || metadata == nil {
+			result = append(result, object)
+			continue
+		}
+		namespaced := Object{}
+		for k, v := range object {
+			namespaced[k] = v
+		}
+		namespacedMetadata := Object{"namespace": namespace}
+		for k, v := range metadata {
+			namespacedMetadata[k] = v
+		}
+		namespaced["metadata"] = namespacedMetadata
+		if _, ok := old[key(namespaced)]; ok {
+			object = namespaced
+		}
+		result = append(result, object)
+	}
+	return result
+}
+
+// withoutAPIVersion returns a copy of the object without its apiVersion, the
+// version is not compared
+func withoutAPIVersion(object Object) Object {
+	result := make(Object, len(object))
+	for k, v := range object {
+		if k != "apiVersion" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// normalize copies the object through JSON, so that numbers compare the same
+// whichever way they were read, without the fields the API server sets
+func normalize(object Object) (Object, error) {
+	b, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var normalized Object
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, err
+	}
+	for _, path := range serverFields {
+		deleteField(normalized, path)
+	}
+	return normalized, nil
+}
+
+// deleteField deletes the field at path and the maps it leaves empty
+func deleteField(object Object, path []string) {
+	if len(path) == 1 {
+		delete(object, path[0])
+		return
+	}
+	next, ok := object[path[0]].(Object)
+	if !ok {
+		return
+	}
+	deleteField(next, path[1:])
+	if len(next) == 0 {
+		delete(object, path[0])
+	}
+}
+
+func compare(path []string, old interface{}, new interface{}, options Options, fields *[]Field) {
+	switch newValue := new.(type) {
+	case Object:
+		oldValue, ok := old.(Object)
+		if !ok {
+			break
+		}
+		for _, key := range keys(oldValue, newValue, options) {
+			compare(appendKey(path, key), oldValue[key], newValue[key], options, fields)
+		}
+		return
+	case []interface{}:
+		oldValue, ok := old.([]interface{})
+		if !ok {
+			break
+		}
+		compareLists(path, oldValue, newValue, options, fields)
+		return
+	case nil:
+		if old == nil || options.IgnoreExtraFields {
+			return
+		}
+	}
+	if !equal(old, new) {
+		*fields = append(*fields, Field{Path: strings.Join(path, "."), Old: old, New: new})
+	}
+}
+
+// compareLists compares lists of named objects, such as containers, ports or
+// env, by name and other lists by index
+func compareLists(path []string, old []interface{}, new []interface{}, options Options, fields *[]Field) {
+	oldNamed, oldOk := named(old)
+	newNamed, newOk := named(new)
+	if oldOk && newOk {
+		for _, name := range keys(oldNamed, newNamed, options) {
+			compare(appendIndex(path, "[name="+name+"]"), oldNamed[name], newNamed[name], options, fields)
+		}
+		return
+	}
+	for i := 0; i < len(old) || i < len(new); i++ {
+		var oldItem, newItem interface{}
+		if i < len(old) {
+			oldItem = old[i]
+		}
+		if i < len(new) {
+			newItem = new[i]
+		}
+		compare(appendIndex(path, fmt.Sprintf("[%d]", i)), oldItem, newItem, options, fields)
+	}
+}
+
+// named indexes a list of objects that all have a distinct name
+func named(list []interface{}) (Object, bool) {
+	result := make(Object, len(list))
+	for _, item := range list {
+		object, ok := item.(Object)
+		if !ok {
+			return nil, false
+		}
+		name, ok := object["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := result[name]; ok {
+			return nil, false
+		}
+		result[name] = object
+	}
+	return result, true
+}
+
+// keys returns the keys of both maps in order, or of new only when extra
+// fields are ignored
+func keys(old Object, new Object, options Options) []string {
+	var result []string
+	for key := range new {
+		result = append(result, key)
+	}
+	if !options.IgnoreExtraFields {
+		for key := range old {
+			if _, ok := new[key]; !ok {
+				result = append(result, key)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func equal(a interface{}, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// appendKey quotes keys that would make the path ambiguous, such as labels
+// and annotations with dots
+func appendKey(path []string, key string) []string {
+	if strings.ContainsAny(key, ".[] ") {
+		return appendIndex(path, fmt.Sprintf("[%q]", key))
+	}
+	return append(path, key)
+}
+
+func appendIndex(path []string, index string) []string {
+	if len(path) == 0 {
+		return []string{index}
+	}
+	result := append([]string{}, path[:len(path)-1]...)
+	return append(result, path[len(path)-1]+index)
+}
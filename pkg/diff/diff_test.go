@@ -0,0 +1,205 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const rendered = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: chronos
+  namespace: qliksense
+  labels:
+    app: chronos
+    app.kubernetes.io/version: 1.2.0
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: metrics
+        image: metrics:1
+      - name: chronos
+        image: chronos:1.2.0
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: chronos
+  namespace: qliksense
+data:
+  password: bmV3
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: chronos
+  namespace: qliksense
+`
+
+const snapshot = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: chronos
+    namespace: qliksense
+    uid: 5d0b
+    resourceVersion: "1234"
+    annotations:
+      deployment.kubernetes.io/revision: "3"
+    labels:
+      app: chronos
+      app.kubernetes.io/version: 1.1.0
+  spec:
+    replicas: 2
+    progressDeadlineSeconds: 600
+    template:
+      spec:
+        containers:
+        - name: chronos
+          image: chronos:1.1.0
+          terminationMessagePath: /dev/termination-log
+        - name: metrics
+          image: metrics:1
+  status:
+    replicas: 2
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: chronos
+    namespace: qliksense
+  data:
+    password: b2xk
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: chronos
+    namespace: qliksense
+`
+
+func TestRead(t *testing.T) {
+	objects, err := Read(strings.NewReader(snapshot + "---\n" + rendered))
+	require.NoError(t, err)
+	require.Len(t, objects, 6)
+	require.Equal(t, "Deployment", objects[0]["kind"])
+	require.Equal(t, "Service", objects[5]["kind"])
+}
+
+func TestCompare(t *testing.T) {
+	old, err := Read(strings.NewReader(snapshot))
+	require.NoError(t, err)
+	new, err := Read(strings.NewReader(rendered))
+	require.NoError(t, err)
+
+	changes, err := Compare(old, new, Options{IgnoreExtraFields: true})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, Format(&out, changes))
+	require.Equal(t, `~ apps/v1 Deployment qliksense/chronos
+    metadata.labels["app.kubernetes.io/version"]: "1.1.0" -> "1.2.0"
+    spec.template.spec.containers[name=chronos].image: "chronos:1.1.0" -> "chronos:1.2.0"
+- v1 ConfigMap qliksense/chronos
+~ v1 Secret qliksense/chronos
+    data.password: <secret value changed>
++ v1 Service qliksense/chronos
+`, out.String())
+
+	// defaults of the cluster are changes unless extra fields are ignored
+	changes, err = Compare(old, new, Options{})
+	require.NoError(t, err)
+	require.Equal(t, Changed, changes[0].Type)
+	require.Contains(t, changes[0].Fields, Field{Path: "spec.progressDeadlineSeconds", Old: float64(600)})
+
+	changes, err = Compare(new, new, Options{})
+	require.NoError(t, err)
+	require.Empty(t, changes)
+}
+
+func TestCompareDuplicate(t *testing.T) {
+	new, err := Read(strings.NewReader(rendered + "---\n" + rendered))
+	require.NoError(t, err)
+	_, err = Compare(nil, new, Options{})
+	require.EqualError(t, err, "duplicate resource apps/v1 Deployment qliksense/chronos")
+}
+
+// component is a component rendered without the namespace of its profile
+const component = `
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: engine
+spec:
+  replicas: 2
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  name: engine
+rules: []
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: engine-config
+data:
+  mode: new
+`
+
+// cluster is a snapshot of the component from kubectl get -o yaml, the
+// cluster serves the Deployment as apps/v1 and the ClusterRole as v1
+const cluster = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: engine
+    namespace: qliksense
+    uid: 5d0b
+  spec:
+    replicas: 1
+    revisionHistoryLimit: 10
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRole
+  metadata:
+    name: engine
+  rules: []
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: engine-config
+    namespace: qliksense
+  data:
+    mode: old
+`
+
+func TestCompareSnapshot(t *testing.T) {
+	old, err := Read(strings.NewReader(cluster))
+	require.NoError(t, err)
+	new, err := Read(strings.NewReader(component))
+	require.NoError(t, err)
+
+	changes, err := Compare(old, new, Options{IgnoreExtraFields: true, Namespace: "qliksense"})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, Format(&out, changes))
+	require.Equal(t, `~ extensions/v1beta1 Deployment qliksense/engine
+    spec.replicas: 1 -> 2
+~ v1 ConfigMap qliksense/engine-config
+    data.mode: "old" -> "new"
+`, out.String())
+
+	// without the namespace the namespaced resources are different ones
+	changes, err = Compare(old, new, Options{IgnoreExtraFields: true})
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+}
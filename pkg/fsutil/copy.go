@@ -0,0 +1,133 @@
+// Package fsutil stages chart directories for the plugins, copying them
+// with their file modes and symlinks and without the files their
+// .helmignore excludes.
+package fsutil
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// HelmIgnore is the file of ignore patterns at the root of a chart
+const HelmIgnore = ".helmignore"
+
+// CopyDir copies the tree at source to dest, which is created. Files and
+// directories matching the .helmignore of source are skipped, modes are kept
+// and symlinks are copied as symlinks.
+func CopyDir(source string, dest string) error {
+	rules, err := ReadIgnoreFile(filepath.Join(source, HelmIgnore))
+	if err != nil {
+		return err
+	}
+	return copyDir(source, dest, "", rules)
+}
+
+func copyDir(source string, dest string, rel string, rules *IgnoreRules) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryRel := filepath.Join(rel, entry.Name())
+		if rules.Ignore(entryRel, entry) {
+			continue
+		}
+		from := filepath.Join(source, entry.Name())
+		to := filepath.Join(dest, entry.Name())
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			err = copySymlink(from, to)
+		case entry.IsDir():
+			err = copyDir(from, to, entryRel, rules)
+		case entry.Mode().IsRegular():
+			err = CopyFile(from, to)
+		default:
+			err = fmt.Errorf("%s: unsupported file type %v", from, entry.Mode().Type())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// the mode is set last so that read-only directories can be filled
+	return os.Chmod(dest, info.Mode().Perm())
+}
+
+// WalkDir calls fn for every file, directory and symlink under source that
+// CopyDir copies, in lexical order, with its path relative to source.
+func WalkDir(source string, fn func(rel string, info os.FileInfo) error) error {
+	rules, err := ReadIgnoreFile(filepath.Join(source, HelmIgnore))
+	if err != nil {
+		return err
+	}
+	return walkDir(source, "", rules, fn)
+}
+
+func walkDir(source string, rel string, rules *IgnoreRules, fn func(rel string, info os.FileInfo) error) error {
+	entries, err := ioutil.ReadDir(filepath.Join(source, rel))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryRel := filepath.Join(rel, entry.Name())
+		if rules.Ignore(entryRel, entry) {
+			continue
+		}
+		if err := fn(entryRel, entry); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if err := walkDir(source, entryRel, rules, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CopyFile copies the regular file at source to dest with its mode.
+func CopyFile(source string, dest string) (err error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := destFile.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if _, err = io.Copy(destFile, sourceFile); err != nil {
+		return fmt.Errorf("copy %s: %v", source, err)
+	}
+	// the mode passed to OpenFile is masked by the umask
+	return destFile.Chmod(info.Mode().Perm())
+}
+
+func copySymlink(source string, dest string) error {
+	target, err := os.Readlink(source)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dest)
+}
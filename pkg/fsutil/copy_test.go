@@ -0,0 +1,93 @@
+package fsutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, content string, mode os.FileMode) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), mode))
+	require.NoError(t, os.Chmod(path, mode))
+}
+
+func TestCopyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "chart")
+	dest := filepath.Join(dir, "staged", "chart")
+
+	writeFile(t, filepath.Join(source, HelmIgnore), "# editor files\n*.swp\n.git/\nci/\n/docs/*.md\n!docs/keep.md\n", 0644)
+	writeFile(t, filepath.Join(source, "Chart.yaml"), "name: engine\n", 0644)
+	writeFile(t, filepath.Join(source, "templates", "deployment.yaml"), "kind: Deployment\n", 0644)
+	writeFile(t, filepath.Join(source, "templates", "deployment.yaml.swp"), "", 0644)
+	writeFile(t, filepath.Join(source, "scripts", "run.sh"), "#!/bin/sh\n", 0755)
+	writeFile(t, filepath.Join(source, ".git", "HEAD"), "ref: refs/heads/master\n", 0644)
+	writeFile(t, filepath.Join(source, "ci", "values.yaml"), "", 0644)
+	writeFile(t, filepath.Join(source, "docs", "README.md"), "", 0644)
+	writeFile(t, filepath.Join(source, "docs", "keep.md"), "", 0644)
+	writeFile(t, filepath.Join(source, "templates", "ci"), "a file, not the ci directory\n", 0644)
+	require.NoError(t, os.Symlink("templates/deployment.yaml", filepath.Join(source, "link.yaml")))
+
+	require.NoError(t, CopyDir(source, dest))
+
+	for _, kept := range []string{"Chart.yaml", HelmIgnore, "templates/deployment.yaml", "scripts/run.sh", "docs/keep.md", "templates/ci"} {
+		_, err := os.Lstat(filepath.Join(dest, kept))
+		require.NoError(t, err, kept)
+	}
+	for _, ignored := range []string{"templates/deployment.yaml.swp", ".git", "ci", "docs/README.md"} {
+		_, err := os.Lstat(filepath.Join(dest, ignored))
+		require.True(t, os.IsNotExist(err), ignored)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "scripts", "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	target, err := os.Readlink(filepath.Join(dest, "link.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "templates/deployment.yaml", target)
+}
+
+func TestWalkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, HelmIgnore), "*.swp\nci/\n", 0644)
+	writeFile(t, filepath.Join(dir, "Chart.yaml"), "name: engine\n", 0644)
+	writeFile(t, filepath.Join(dir, "templates", "deployment.yaml"), "kind: Deployment\n", 0644)
+	writeFile(t, filepath.Join(dir, "templates", "deployment.yaml.swp"), "", 0644)
+	writeFile(t, filepath.Join(dir, "ci", "values.yaml"), "", 0644)
+
+	var walked []string
+	require.NoError(t, WalkDir(dir, func(rel string, info os.FileInfo) error {
+		walked = append(walked, filepath.ToSlash(rel))
+		return nil
+	}))
+	require.Equal(t, []string{HelmIgnore, "Chart.yaml", "templates", "templates/deployment.yaml"}, walked)
+}
+
+func TestCopyDirErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = CopyDir(filepath.Join(dir, "missing"), filepath.Join(dir, "dest"))
+	require.Error(t, err)
+
+	writeFile(t, filepath.Join(dir, "chart", HelmIgnore), "[\n", 0644)
+	err = CopyDir(filepath.Join(dir, "chart"), filepath.Join(dir, "dest"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 1")
+
+	if os.Getuid() != 0 {
+		writeFile(t, filepath.Join(dir, "private", "secret.yaml"), "", 0000)
+		err = CopyDir(filepath.Join(dir, "private"), filepath.Join(dir, "dest"))
+		require.Error(t, err)
+	}
+}
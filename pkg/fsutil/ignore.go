@@ -0,0 +1,102 @@
+package fsutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreRules are the patterns of a .helmignore file, they follow the rules
+// helm applies: a pattern without a slash matches the base name at any depth,
+// one with a slash matches the path from the root, a trailing slash only
+// matches directories and a leading ! negates the pattern. The last
+// matching pattern decides.
+type IgnoreRules struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+	rooted  bool
+}
+
+// ReadIgnoreFile parses the ignore file at path, a missing file ignores
+// nothing.
+func ReadIgnoreFile(path string) (*IgnoreRules, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &IgnoreRules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseIgnore(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// ParseIgnore parses ignore patterns, one per line, # starts a comment.
+func ParseIgnore(content []byte) (*IgnoreRules, error) {
+	rules := &IgnoreRules{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if strings.HasPrefix(text, "!") {
+			p.negate = true
+			text = text[1:]
+		}
+		if strings.HasSuffix(text, "/") {
+			p.dirOnly = true
+			text = strings.TrimSuffix(text, "/")
+		}
+		if strings.Contains(text, "/") {
+			p.rooted = true
+			text = strings.TrimPrefix(text, "/")
+		}
+		if strings.Contains(text, "**") {
+			return nil, fmt.Errorf("line %d: ** is not supported", line)
+		}
+		if _, err := filepath.Match(text, ""); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		p.pattern = text
+		rules.patterns = append(rules.patterns, p)
+	}
+	return rules, scanner.Err()
+}
+
+// Ignore reports whether the file at rel, relative to the chart root, is
+// ignored.
+func (r *IgnoreRules) Ignore(rel string, info os.FileInfo) bool {
+	// the chart metadata is always kept
+	if rel == "Chart.yaml" {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	ignored := false
+	for _, p := range r.patterns {
+		if p.dirOnly && !info.IsDir() {
+			continue
+		}
+		name := filepath.Base(rel)
+		if p.rooted {
+			name = rel
+		}
+		if matched, _ := filepath.Match(p.pattern, name); matched {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
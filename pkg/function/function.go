@@ -0,0 +1,189 @@
+// Package function runs the qlik.com/v1 plugins as a KRM function, reading
+// and writing a ResourceList, or as a kustomize exec plugin.
+package function
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/qlik-trial/qliksense-config/pkg/plugins"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/transformers"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	resourceListAPIVersion = "config.kubernetes.io/v1"
+	resourceListKind       = "ResourceList"
+)
+
+// documentSeparator ends a document of a YAML stream, a line of --- alone
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// ResourceList is the input and output of a KRM function.
+type ResourceList struct {
+	APIVersion     string                   `json:"apiVersion" yaml:"apiVersion"`
+	Kind           string                   `json:"kind" yaml:"kind"`
+	Items          []map[string]interface{} `json:"items" yaml:"items"`
+	FunctionConfig map[string]interface{}   `json:"functionConfig,omitempty" yaml:"functionConfig,omitempty"`
+	Results        []Result                 `json:"results,omitempty" yaml:"results,omitempty"`
+}
+
+// Result reports a failure of the function.
+type Result struct {
+	Message  string `json:"message" yaml:"message"`
+	Severity string `json:"severity" yaml:"severity"`
+}
+
+// RunResourceList reads a ResourceList, runs the plugin of its functionConfig
+// over the items and writes the ResourceList back. The plugin loads the
+// files of its config through ldr. On failure the ResourceList is written
+// with an error result and the error is returned.
+func RunResourceList(in io.Reader, out io.Writer, ldr ifc.Loader) error {
+	input, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	var list ResourceList
+	if err := yaml.Unmarshal(input, &list); err != nil {
+		return fmt.Errorf("reading ResourceList: %v", err)
+	}
+	if list.Kind != resourceListKind {
+		return fmt.Errorf("expected a %s, got kind %q", resourceListKind, list.Kind)
+	}
+
+	items, err := run(list.FunctionConfig, list.Items, ldr)
+	list.APIVersion = resourceListAPIVersion
+	if err != nil {
+		list.Results = append(list.Results, Result{Message: err.Error(), Severity: "error"})
+	} else {
+		list.Items = items
+	}
+	output, marshalErr := yaml.Marshal(list)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	if _, writeErr := out.Write(output); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// RunExec runs the plugin configured in config as kustomize runs exec
+// plugins, resources to transform are read from in as a YAML stream and the
+// result is written to out. The plugin loads the files of its config through
+// ldr.
+func RunExec(config []byte, in io.Reader, out io.Writer, ldr ifc.Loader) error {
+	var functionConfig map[string]interface{}
+	if err := yaml.Unmarshal(config, &functionConfig); err != nil {
+		return fmt.Errorf("reading plugin config: %v", err)
+	}
+	input, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	var items []map[string]interface{}
+	for _, document := range documentSeparator.Split(string(input), -1) {
+		var item map[string]interface{}
+		if err := yaml.Unmarshal([]byte(document), &item); err != nil {
+			return err
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	items, err = run(functionConfig, items, ldr)
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		if i > 0 {
+			if _, err := io.WriteString(out, "---\n"); err != nil {
+				return err
+			}
+		}
+		output, err := yaml.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run configures the plugin of the config's kind, generated resources are
+// appended to items and transformers change them
+func run(functionConfig map[string]interface{}, items []map[string]interface{}, ldr ifc.Loader) ([]map[string]interface{}, error) {
+	if functionConfig == nil {
+		return nil, errors.New("no functionConfig")
+	}
+	apiVersion, _ := functionConfig["apiVersion"].(string)
+	kind, _ := functionConfig["kind"].(string)
+	if apiVersion != plugins.APIVersion {
+		return nil, fmt.Errorf("functionConfig apiVersion %q is not %s", apiVersion, plugins.APIVersion)
+	}
+	plugin, err := plugins.New(kind)
+	if err != nil {
+		return nil, err
+	}
+	config, err := yaml.Marshal(functionConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	rf := plugins.NewFactory()
+	if err := plugin.Config(ldr, rf, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", kind, err)
+	}
+
+	m, err := toResMap(rf, items)
+	if err != nil {
+		return nil, err
+	}
+	switch p := plugin.(type) {
+	case transformers.Generator:
+		generated, err := p.Generate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", kind, err)
+		}
+		if err := m.AppendAll(generated); err != nil {
+			return nil, err
+		}
+	case transformers.Transformer:
+		if err := p.Transform(m); err != nil {
+			return nil, fmt.Errorf("%s: %v", kind, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s is neither a generator nor a transformer", kind)
+	}
+
+	var result []map[string]interface{}
+	for _, r := range m.Resources() {
+		result = append(result, r.Map())
+	}
+	return result, nil
+}
+
+func toResMap(rf *resmap.Factory, items []map[string]interface{}) (resmap.ResMap, error) {
+	var stream bytes.Buffer
+	for _, item := range items {
+		b, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		stream.WriteString("---\n")
+		stream.Write(b)
+	}
+	if stream.Len() == 0 {
+		return resmap.New(), nil
+	}
+	return rf.NewResMapFromBytes(stream.Bytes())
+}
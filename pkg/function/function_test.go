@@ -0,0 +1,163 @@
+package function
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qlik-trial/qliksense-config/pkg/plugins"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/v3/pkg/loader"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRunResourceList(t *testing.T) {
+	root, err := ioutil.TempDir("", "function")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "values.yaml"), []byte("replicas: 3\n"), 0644))
+	ldr, err := plugins.NewLoader(loader.RestrictionRootOnly, root)
+	require.NoError(t, err)
+
+	in := `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+functionConfig:
+  apiVersion: qlik.com/v1
+  kind: ValuesFile
+  metadata:
+    name: qliksense
+  enabled: true
+  valuesFile: values.yaml
+items:
+- apiVersion: qlik.com/v1
+  kind: HelmChart
+  metadata:
+    name: engine
+  chartName: engine
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: engine
+`
+	var out bytes.Buffer
+	require.NoError(t, RunResourceList(strings.NewReader(in), &out, ldr))
+
+	var list ResourceList
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &list))
+	require.Equal(t, "ResourceList", list.Kind)
+	require.Len(t, list.Items, 2)
+	require.Equal(t, map[string]interface{}{"replicas": float64(3)}, list.Items[0]["values"])
+	require.NotContains(t, list.Items[1], "values")
+	require.Empty(t, list.Results)
+
+	out.Reset()
+	err = RunResourceList(strings.NewReader(strings.Replace(in, "kind: ValuesFile", "kind: Unknown", 1)), &out, ldr)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown plugin kind "Unknown"`)
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &list))
+	require.Len(t, list.Results, 1)
+	require.Equal(t, "error", list.Results[0].Severity)
+}
+
+func TestRunExec(t *testing.T) {
+	root, err := ioutil.TempDir("", "function")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	ldr, err := plugins.NewLoader(loader.RestrictionRootOnly, root)
+	require.NoError(t, err)
+
+	config := `
+apiVersion: qlik.com/v1
+kind: HelmValues
+metadata:
+  name: qliksense
+releaseNamespace: qlik
+values:
+  global:
+    region: us-east-1
+`
+	in := `apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: engine
+  annotations:
+    config.kubernetes.io/id: engine
+chartName: engine
+---
+apiVersion: qlik.com/v1
+kind: HelmChart
+metadata:
+  name: edge-auth
+chartName: edge-auth
+`
+	var out bytes.Buffer
+	require.NoError(t, RunExec([]byte(config), strings.NewReader(in), &out, ldr))
+	require.Equal(t, `apiVersion: qlik.com/v1
+chartName: engine
+kind: HelmChart
+metadata:
+  annotations:
+    config.kubernetes.io/id: engine
+  name: engine
+releaseNamespace: qlik
+values:
+  global:
+    region: us-east-1
+---
+apiVersion: qlik.com/v1
+chartName: edge-auth
+kind: HelmChart
+metadata:
+  name: edge-auth
+releaseNamespace: qlik
+values:
+  global:
+    region: us-east-1
+`, out.String())
+
+	// only a line of --- alone separates documents, not one starting with it
+	// in a scalar
+	in = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: motd
+data:
+  banner: "welcome
+---------"
+  script: |
+    echo ---
+    ---
+--- 
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: empty
+`
+	out.Reset()
+	require.NoError(t, RunExec([]byte(config), strings.NewReader(in), &out, ldr))
+	require.Equal(t, `apiVersion: v1
+data:
+  banner: welcome ---------
+  script: |
+    echo ---
+    ---
+kind: ConfigMap
+metadata:
+  name: motd
+releaseNamespace: qlik
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: empty
+releaseNamespace: qlik
+`, out.String())
+
+	err = RunExec([]byte("apiVersion: builtin\nkind: PatchTransformer\n"), strings.NewReader(in), &out, ldr)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not qlik.com/v1")
+}
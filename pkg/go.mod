@@ -0,0 +1,14 @@
+module github.com/qlik-trial/qliksense-config/pkg
+
+go 1.12
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/evanphx/json-patch v4.5.0+incompatible
+	github.com/imdario/mergo v0.3.7
+	github.com/pkg/errors v0.8.1
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	sigs.k8s.io/kustomize/v3 v3.1.0
+	sigs.k8s.io/yaml v1.1.0
+)
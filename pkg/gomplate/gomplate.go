@@ -0,0 +1,115 @@
+// Package gomplate renders templates in-process, with the (( )) delimiters
+// by default, and the subset of gomplate functions used by the configs.
+package gomplate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"text/template"
+)
+
+const (
+	DefaultLeftDelim  = "(("
+	DefaultRightDelim = "))"
+)
+
+// Render executes the template against the named datasources, errors are
+// prefixed with the template name and line.
+func Render(name string, temp string, dataSources map[string]interface{}) ([]byte, error) {
+	return RenderDelims(name, temp, DefaultLeftDelim, DefaultRightDelim, dataSources)
+}
+
+// RenderDelims is Render with the given action delimiters, empty ones
+// default to (( and )).
+func RenderDelims(name string, temp string, left string, right string, dataSources map[string]interface{}) ([]byte, error) {
+	if left == "" {
+		left = DefaultLeftDelim
+	}
+	if right == "" {
+		right = DefaultRightDelim
+	}
+	tmpl, err := template.New(name).
+		Delims(left, right).
+		Funcs(Funcs(dataSources)).
+		Parse(temp)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, nil)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Funcs returns the template functions, datasource and ds look up
+// dataSources by alias.
+func Funcs(dataSources map[string]interface{}) template.FuncMap {
+	datasource := func(alias string) (interface{}, error) {
+		data, ok := dataSources[alias]
+		if !ok {
+			return nil, fmt.Errorf("undefined datasource '%s'", alias)
+		}
+		return data, nil
+	}
+	return template.FuncMap{
+		"datasource": datasource,
+		"ds":         datasource,
+		"base64":     func() base64Funcs { return base64Funcs{} },
+		"default":    defaultValue,
+		"required":   required,
+		"has":        has,
+	}
+}
+
+type base64Funcs struct{}
+
+func (base64Funcs) Encode(in interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v", in)))
+}
+
+func (base64Funcs) Decode(in interface{}) (string, error) {
+	out, err := base64.StdEncoding.DecodeString(fmt.Sprintf("%v", in))
+	return string(out), err
+}
+
+func defaultValue(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || empty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+func required(msg string, value interface{}) (interface{}, error) {
+	if empty(value) {
+		return nil, errors.New(msg)
+	}
+	return value, nil
+}
+
+func has(in interface{}, key string) bool {
+	m, ok := in.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = m[key]
+	return ok
+}
+
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	}
+	return false
+}
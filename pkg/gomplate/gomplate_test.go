@@ -0,0 +1,54 @@
+package gomplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	dataSources := map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "s3cr3t",
+			"enabled":  false,
+		},
+	}
+
+	out, err := Render("test", `password: (( (ds "data").password | base64.Encode ))
+decoded: (( base64.Decode "czNjcjN0" ))
+zone: (( (datasource "data").zone | default "a" ))
+enabled: (( (ds "data").enabled | default true ))
+has: (( has (ds "data") "password" ))
+`, dataSources)
+	require.NoError(t, err)
+	require.Equal(t, `password: czNjcjN0
+decoded: s3cr3t
+zone: a
+enabled: true
+has: true
+`, string(out))
+
+	out, err = RenderDelims("test", `password: [[ (ds "data").password ]]
+literal: (( not a template ))
+`, "[[", "]]", dataSources)
+	require.NoError(t, err)
+	require.Equal(t, `password: s3cr3t
+literal: (( not a template ))
+`, string(out))
+}
+
+func TestRenderErrors(t *testing.T) {
+	_, err := Render("Secret/mongodb", "a: 1\nb: (( required \"b is required\" (ds \"data\").b ))\n",
+		map[string]interface{}{"data": map[string]interface{}{}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Secret/mongodb:2:")
+	require.Contains(t, err.Error(), "b is required")
+
+	_, err = Render("Secret/mongodb", "a: (( ds \"missing\" ))", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "undefined datasource 'missing'")
+
+	_, err = Render("Secret/mongodb", "a: (( ds \"data\" ", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Secret/mongodb:1:")
+}
@@ -0,0 +1,65 @@
+// Package helm wraps the helm client the HelmChart plugin renders charts
+// with.
+package helm
+
+import (
+	"github.com/qlik-trial/qliksense-config/pkg/command"
+)
+
+// Helm runs Bin, helm by default, with Home as its home directory.
+type Helm struct {
+	Bin  string
+	Home string
+}
+
+// TemplateOptions are the release and values of a helm template.
+type TemplateOptions struct {
+	ReleaseName string
+	Namespace   string
+	ValuesFiles []string
+	ExtraArgs   []string
+}
+
+func (h Helm) run(args ...string) ([]byte, error) {
+	bin := h.Bin
+	if bin == "" {
+		bin = "helm"
+	}
+	if h.Home != "" {
+		args = append(args[:1:1], append([]string{"--home=" + h.Home}, args[1:]...)...)
+	}
+	return command.Run("", bin, args...)
+}
+
+// Init initializes the helm home without installing tiller.
+func (h Helm) Init() error {
+	_, err := h.run("init", "--client-only")
+	return err
+}
+
+// Fetch downloads and untars the chart from repo into untarDir, the latest
+// version when version is empty.
+func (h Helm) Fetch(repo string, chart string, version string, untarDir string) error {
+	args := []string{"fetch", "--untar", "--untardir=" + untarDir, "--repo=" + repo}
+	if version != "" {
+		args = append(args, "--version="+version)
+	}
+	_, err := h.run(append(args, chart)...)
+	return err
+}
+
+// Template renders the chart at chartHome.
+func (h Helm) Template(chartHome string, options TemplateOptions) ([]byte, error) {
+	args := []string{"template"}
+	for _, valuesFile := range options.ValuesFiles {
+		args = append(args, "--values="+valuesFile)
+	}
+	if options.ReleaseName != "" {
+		args = append(args, "--name="+options.ReleaseName)
+	}
+	if options.Namespace != "" {
+		args = append(args, "--namespace="+options.Namespace)
+	}
+	args = append(args, chartHome)
+	return h.run(append(args, options.ExtraArgs...)...)
+}
@@ -0,0 +1,45 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHelm writes a helm stand-in that prints its arguments, one per line
+func fakeHelm(t *testing.T, dir string) string {
+	bin := filepath.Join(dir, "helm")
+	require.NoError(t, ioutil.WriteFile(bin, []byte("#!/bin/sh\nfor arg in \"$@\"; do echo \"$arg\"; done\n"), 0755))
+	return bin
+}
+
+func TestHelm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	h := Helm{Bin: fakeHelm(t, dir), Home: "/helm"}
+
+	out, err := h.Template("/charts/engine", TemplateOptions{
+		ReleaseName: "qliksense",
+		Namespace:   "qlik",
+		ValuesFiles: []string{"/tmp/values.yaml"},
+		ExtraArgs:   []string{"--set=a=b"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"template", "--home=/helm", "--values=/tmp/values.yaml", "--name=qliksense",
+		"--namespace=qlik", "/charts/engine", "--set=a=b",
+	}, strings.Fields(string(out)))
+
+	require.NoError(t, h.Init())
+	require.NoError(t, h.Fetch("https://charts", "engine", "", "/charts"))
+
+	h.Bin = filepath.Join(dir, "missing")
+	err = h.Fetch("https://charts", "engine", "1.0.0", "/charts")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fetch --home=/helm --untar")
+}
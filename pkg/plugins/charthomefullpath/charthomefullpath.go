@@ -0,0 +1,363 @@
+// Package charthomefullpath is the ChartHomeFullPath transformer, it stages the chart homes of HelmCharts and points them at the staged copies.
+package charthomefullpath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/fsutil"
+	"sigs.k8s.io/kustomize/v3/pkg/git"
+	"sigs.k8s.io/kustomize/v3/pkg/gvk"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/pgmconfig"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/transformers"
+	"sigs.k8s.io/kustomize/v3/pkg/transformers/config"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// defaultStagingDir is where charts are staged under the temp directory
+	defaultStagingDir = "qliksense-charthome"
+	// sourceFile records the chart home a staging was copied from
+	sourceFile = ".source"
+)
+
+// documentSeparator ends a document of a YAML stream, a line of --- alone
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// defaultFieldSpecs is the chartHome of HelmCharts
+var defaultFieldSpecs = []config.FieldSpec{
+	{Gvk: gvk.Gvk{Kind: "HelmChart"}, Path: "chartHome", CreateIfNotPresent: true},
+}
+
+// Plugin is the ChartHomeFullPath transformer, configured from a ChartHomeFullPath resource.
+type Plugin struct {
+	// ChartHome is the chart of every resource when set, it is a path or a
+	// remote git base. Resources use their own chartHome otherwise, relative
+	// to the kustomization, or base, declaring them. Bases are followed from
+	// the kustomization listing this transformer, remote ones included.
+	ChartHome string `json:"chartHome,omitempty" yaml:"chartHome,omitempty"`
+	// FieldSpecs select the kinds and fields to act on, the chartHome of
+	// HelmCharts by default. Other kinds are staged the same way and need a
+	// chartName too.
+	FieldSpecs []config.FieldSpec `json:"fieldSpecs,omitempty" yaml:"fieldSpecs,omitempty"`
+	// StagingDir holds the staged charts, one directory per chart name and
+	// content hash, so repeated builds reuse them. Stagings are shared and
+	// never changed, HelmChart changes a copy of its chart.
+	StagingDir string `json:"stagingDir,omitempty" yaml:"stagingDir,omitempty"`
+	Root       string
+	ldr        ifc.Loader
+	remotes    map[string]ifc.Loader
+	hashes     map[string]string
+	// origins are the roots of the kustomizations declaring the resources,
+	// by kind and name
+	origins map[string]string
+}
+
+func (p *Plugin) Config(
+	ldr ifc.Loader, rf *resmap.Factory, c []byte) (err error) {
+	p.ldr = ldr
+	p.Root = ldr.Root()
+	p.remotes = map[string]ifc.Loader{}
+	p.hashes = map[string]string{}
+	return yaml.Unmarshal(c, p)
+}
+
+func (p *Plugin) Transform(m resmap.ResMap) error {
+	defer p.cleanupRemotes()
+	if p.StagingDir == "" {
+		p.StagingDir = filepath.Join(os.TempDir(), defaultStagingDir)
+	}
+	fieldSpecs := p.FieldSpecs
+	if len(fieldSpecs) == 0 {
+		fieldSpecs = defaultFieldSpecs
+	}
+	for _, r := range m.Resources() {
+		chartName := GetFieldValue(r, "chartName")
+		for _, fs := range fieldSpecs {
+			if !r.GetGvk().IsSelected(&fs.Gvk) {
+				continue
+			}
+			err := transformers.MutateField(
+				r.Map(),
+				fs.PathSlice(),
+				fs.CreateIfNotPresent,
+				func(in interface{}) (interface{}, error) {
+					chartHome, _ := in.(string)
+					if chartName == "" {
+						return nil, fmt.Errorf("%s/%s: no chartName is set", r.GetKind(), r.GetName())
+					}
+					source, err := p.chartSource(r.GetKind(), r.GetName(), chartHome)
+					if err != nil {
+						return nil, fmt.Errorf("%s/%s: %v", r.GetKind(), r.GetName(), err)
+					}
+					hash, err := p.hash(source)
+					if err != nil {
+						return nil, err
+					}
+					return p.stage(chartName, source, hash)
+				})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// chartSource returns the chart directory to stage for a resource with
+// chartHome, the chartHome of the config wins.
+func (p *Plugin) chartSource(kind string, name string, chartHome string) (string, error) {
+	if p.ChartHome != "" {
+		return p.resolve(p.ChartHome, p.Root)
+	}
+	if chartHome == "" {
+		return "", fmt.Errorf("no chartHome is set")
+	}
+	origin, err := p.origin(kind, name)
+	if err != nil {
+		return "", err
+	}
+	return p.resolve(chartHome, origin)
+}
+
+// resolve returns the directory of a remote git base, cloned once per
+// build, an absolute path or a path relative to root
+func (p *Plugin) resolve(location string, root string) (string, error) {
+	if _, err := git.NewRepoSpecFromUrl(location); err == nil {
+		remote, err := p.remote(p.ldr, location)
+		if err != nil {
+			return "", err
+		}
+		return remote.Root(), nil
+	}
+	if filepath.IsAbs(location) {
+		return location, nil
+	}
+	return filepath.Join(root, location), nil
+}
+
+func (p *Plugin) remote(ldr ifc.Loader, location string) (ifc.Loader, error) {
+	if remote, ok := p.remotes[location]; ok {
+		return remote, nil
+	}
+	remote, err := ldr.New(location)
+	if err != nil {
+		return nil, err
+	}
+	p.remotes[location] = remote
+	return remote, nil
+}
+
+// origin returns the root of the kustomization declaring the resource, that
+// of the kustomization listing this transformer when no base declares it
+func (p *Plugin) origin(kind string, name string) (string, error) {
+	if p.origins == nil {
+		p.origins = map[string]string{}
+		if err := p.findOrigins(p.ldr, map[string]bool{}); err != nil {
+			return "", err
+		}
+	}
+	if origin, ok := p.origins[kind+"/"+name]; ok {
+		return origin, nil
+	}
+	return p.Root, nil
+}
+
+// findOrigins records the root of ldr for the resources its kustomization
+// declares in files, and follows its bases, the first to declare a
+// resource wins
+func (p *Plugin) findOrigins(ldr ifc.Loader, visited map[string]bool) error {
+	if visited[ldr.Root()] {
+		return nil
+	}
+	visited[ldr.Root()] = true
+	var k types.Kustomization
+	for _, name := range pgmconfig.KustomizationFileNames {
+		content, err := ldr.Load(name)
+		if err != nil {
+			continue
+		}
+		if err := yaml.Unmarshal(content, &k); err != nil {
+			return fmt.Errorf("%s: %v", filepath.Join(ldr.Root(), name), err)
+		}
+		break
+	}
+	for _, entry := range append(k.Bases, k.Resources...) {
+		entry = strings.TrimSpace(entry)
+		if _, err := git.NewRepoSpecFromUrl(entry); err == nil {
+			remote, err := p.remote(ldr, entry)
+			if err != nil {
+				return err
+			}
+			if err := p.findOrigins(remote, visited); err != nil {
+				return err
+			}
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(ldr.Root(), entry)); err == nil && info.IsDir() {
+			base, err := ldr.New(entry)
+			if err != nil {
+				return err
+			}
+			if err := p.findOrigins(base, visited); err != nil {
+				return err
+			}
+			continue
+		}
+		content, err := ldr.Load(entry)
+		if err != nil {
+			return err
+		}
+		for _, document := range documentSeparator.Split(string(content), -1) {
+			var object struct {
+				Kind     string `json:"kind"`
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}
+			if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+				return fmt.Errorf("%s: %v", filepath.Join(ldr.Root(), entry), err)
+			}
+			key := object.Kind + "/" + object.Metadata.Name
+			if _, ok := p.origins[key]; !ok && object.Kind != "" {
+				p.origins[key] = ldr.Root()
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) cleanupRemotes() {
+	for location, remote := range p.remotes {
+		_ = remote.Cleanup()
+		delete(p.remotes, location)
+	}
+}
+
+func (p *Plugin) hash(source string) (string, error) {
+	if hash, ok := p.hashes[source]; ok {
+		return hash, nil
+	}
+	hash, err := hashDir(source)
+	if err != nil {
+		return "", err
+	}
+	p.hashes[source] = hash
+	return hash, nil
+}
+
+// stage returns the staging directory of the chart for the hash, copying
+// source into it when it is not staged yet. Stagings of the chart with other
+// hashes are removed.
+func (p *Plugin) stage(chartName string, source string, hash string) (string, error) {
+	err := os.MkdirAll(p.StagingDir, 0777)
+	if err != nil {
+		return "", err
+	}
+	name := chartName + "-" + hash
+	staged := filepath.Join(p.StagingDir, name)
+
+	if _, err := os.Stat(staged); os.IsNotExist(err) {
+		// copy to a temporary directory first so that an interrupted build
+		// never leaves a partial staging behind
+		tmp, err := ioutil.TempDir(p.StagingDir, ".staging-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmp)
+		dest := filepath.Join(tmp, chartName)
+		if err := fsutil.CopyDir(source, dest); err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(filepath.Join(tmp, sourceFile), []byte(source), 0644)
+		if err != nil {
+			return "", err
+		}
+		// the staging is the same whoever renames first
+		if err := os.Rename(tmp, staged); err != nil && !os.IsExist(err) {
+			if _, statErr := os.Stat(staged); statErr != nil {
+				return "", err
+			}
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := p.cleanup(chartName, source, name); err != nil {
+		return "", err
+	}
+	return filepath.Join(staged, chartName), nil
+}
+
+// cleanup removes the stagings of the chart copied from source other than
+// keep, they hold older contents of the chart home
+func (p *Plugin) cleanup(chartName string, source string, keep string) error {
+	entries, err := ioutil.ReadDir(p.StagingDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == keep || !strings.HasPrefix(name, chartName+"-") {
+			continue
+		}
+		stagedSource, err := ioutil.ReadFile(filepath.Join(p.StagingDir, name, sourceFile))
+		if err != nil || string(stagedSource) != source {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(p.StagingDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashDir hashes the paths, modes and contents of the tree at dir that is
+// staged, files its .helmignore excludes do not count
+func hashDir(dir string) (string, error) {
+	hash := sha256.New()
+	err := fsutil.WalkDir(dir, func(rel string, info os.FileInfo) error {
+		file := filepath.Join(dir, rel)
+		fmt.Fprintf(hash, "%s %v\n", filepath.ToSlash(rel), info.Mode())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\n", target)
+		case info.Mode().IsRegular():
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(hash, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+func GetFieldValue(obj ifc.Kunstructured, fieldName string) string {
+	v, err := obj.GetString(fieldName)
+	if err != nil {
+		return ""
+	}
+	return v
+}
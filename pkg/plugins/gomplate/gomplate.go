@@ -0,0 +1,300 @@
+// Package gomplate is the Gomplate transformer, it renders (( )) templates in resources with data from datasources.
+package gomplate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/gomplate"
+	"github.com/qlik-trial/qliksense-config/pkg/secrets"
+	"github.com/qlik-trial/qliksense-config/pkg/selectors"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// dataSource is a secrets.DataSource or, with type resource, the data of
+// another resource in the resmap
+type dataSource struct {
+	secrets.DataSource `json:",inline" yaml:",inline"`
+	Resource           *resourceSource `json:"resource,omitempty" yaml:"resource,omitempty"`
+	// Secret marks the values as secret for failOnSecretLeak, ejson, vault
+	// and sops datasources are secret by default
+	Secret *bool `json:"secret,omitempty" yaml:"secret,omitempty"`
+}
+
+const resourceType = "resource"
+
+// resourceSource selects exactly one resource, FieldPath is the dot
+// separated path of the data in it and defaults to data
+type resourceSource struct {
+	types.Selector `json:",inline" yaml:",inline"`
+	FieldPath      string `json:"fieldPath,omitempty" yaml:"fieldPath,omitempty"`
+}
+
+// Plugin is the Gomplate transformer, configured from a Gomplate resource.
+type Plugin struct {
+	// DataSource is the datasource named data
+	DataSource  dataSource            `json:"dataSource,omitempty" yaml:"dataSource,omitempty"`
+	DataSources map[string]dataSource `json:"dataSources,omitempty" yaml:"dataSources,omitempty"`
+	// Target limits rendering to the selected resources, all by default
+	Target     *types.Selector `json:"target,omitempty" yaml:"target,omitempty"`
+	LeftDelim  string          `json:"leftDelim,omitempty" yaml:"leftDelim,omitempty"`
+	RightDelim string          `json:"rightDelim,omitempty" yaml:"rightDelim,omitempty"`
+	// FailOnSecretLeak fails when a value from a secret datasource is
+	// rendered outside the data or stringData of a Secret
+	FailOnSecretLeak bool `json:"failOnSecretLeak,omitempty" yaml:"failOnSecretLeak,omitempty"`
+	ldr              ifc.Loader
+	rf               *resmap.Factory
+}
+
+func (p *Plugin) Config(
+	ldr ifc.Loader, rf *resmap.Factory, c []byte) (err error) {
+	p.ldr = ldr
+	p.rf = rf
+	if err := yaml.Unmarshal(c, p); err != nil {
+		return err
+	}
+	if p.Target != nil {
+		if err := selectors.Validate(*p.Target); err != nil {
+			return fmt.Errorf("target: %v", err)
+		}
+	}
+	if err := p.DataSource.validate(); err != nil {
+		return fmt.Errorf("dataSource: %v", err)
+	}
+	for name, ds := range p.DataSources {
+		if err := ds.validate(); err != nil {
+			return fmt.Errorf("dataSources.%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the selector of a resource datasource
+func (ds dataSource) validate() error {
+	if ds.Resource == nil {
+		return nil
+	}
+	if err := selectors.Validate(ds.Resource.Selector); err != nil {
+		return fmt.Errorf("resource: %v", err)
+	}
+	return nil
+}
+
+func (p *Plugin) Transform(m resmap.ResMap) error {
+	resources := m.Resources()
+	if p.Target != nil {
+		var err error
+		resources, err = m.Select(*p.Target)
+		if err != nil {
+			return err
+		}
+	}
+
+	leftDelim := p.LeftDelim
+	if leftDelim == "" {
+		leftDelim = gomplate.DefaultLeftDelim
+	}
+	templates := map[*resource.Resource][]byte{}
+	for _, r := range resources {
+		yamlByte, err := r.AsYAML()
+		if err != nil {
+			return err
+		}
+		// resources without template markers are left as they are
+		if bytes.Contains(yamlByte, []byte(leftDelim)) {
+			templates[r] = yamlByte
+		}
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+
+	dataSources, secretValues, err := p.readDataSources(m)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		yamlByte, ok := templates[r]
+		if !ok {
+			continue
+		}
+		output, err := gomplate.RenderDelims(resourceId(r), string(yamlByte),
+			p.LeftDelim, p.RightDelim, dataSources)
+		if err != nil {
+			return err
+		}
+		res, err := p.rf.RF().FromBytes(output)
+		if err != nil {
+			return fmt.Errorf("%s: rendered template is not a valid resource: %v", resourceId(r), err)
+		}
+		if p.FailOnSecretLeak {
+			if err := checkSecretLeak(res, secretValues); err != nil {
+				return fmt.Errorf("%s: %v", resourceId(r), err)
+			}
+		}
+		r.SetMap(res.Map())
+	}
+	return nil
+}
+
+// readDataSources reads the named datasources, dataSource is read as data
+// when it is set or when no other datasource is. The string values of secret
+// datasources are returned with the datasource names.
+func (p *Plugin) readDataSources(m resmap.ResMap) (map[string]interface{}, map[string]string, error) {
+	sources := map[string]dataSource{}
+	for name, ds := range p.DataSources {
+		sources[name] = ds
+	}
+	if len(p.DataSources) == 0 || p.DataSource != (dataSource{}) {
+		if _, ok := sources["data"]; ok {
+			return nil, nil, fmt.Errorf("dataSources.data is already set by dataSource")
+		}
+		sources["data"] = p.DataSource
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := map[string]interface{}{}
+	secretValues := map[string]string{}
+	for _, name := range names {
+		value, secret, err := sources[name].read(p.ldr, m)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dataSources.%s: %v", name, err)
+		}
+		data[name] = value
+		if secret {
+			collectStrings(value, func(s string) {
+				secretValues[s] = name
+			})
+		}
+	}
+	return data, secretValues, nil
+}
+
+func (ds dataSource) read(ldr ifc.Loader, m resmap.ResMap) (interface{}, bool, error) {
+	secret := func(byDefault bool) bool {
+		if ds.Secret != nil {
+			return *ds.Secret
+		}
+		return byDefault
+	}
+	if ds.Type == resourceType || (ds.Type == "" && ds.Resource != nil) {
+		if ds.Resource == nil {
+			return nil, false, fmt.Errorf("type %s requires a resource section", resourceType)
+		}
+		value, err := ds.Resource.read(m)
+		return value, secret(false), err
+	}
+	source, err := ds.Source(ldr)
+	if err != nil {
+		return nil, false, err
+	}
+	value, err := source.Read()
+	switch source.(type) {
+	case *secrets.EjsonSource, *secrets.VaultSource, *secrets.SopsSource:
+		return value, secret(true), err
+	}
+	return value, secret(false), err
+}
+
+func (rs *resourceSource) read(m resmap.ResMap) (interface{}, error) {
+	resources, err := m.Select(rs.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) != 1 {
+		return nil, fmt.Errorf("resource selector matched %d resources, expected 1", len(resources))
+	}
+	fieldPath := rs.FieldPath
+	if fieldPath == "" {
+		fieldPath = "data"
+	}
+	var value interface{} = resources[0].Map()
+	for _, field := range strings.Split(fieldPath, ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not found", resourceId(resources[0]), fieldPath)
+		}
+		if value, ok = fields[field]; !ok {
+			return nil, fmt.Errorf("%s: %s is not found", resourceId(resources[0]), fieldPath)
+		}
+	}
+	return value, nil
+}
+
+// minSecretLength is the length below which secret values are not looked
+// for, short values such as true or 443 are too common to be leaks
+const minSecretLength = 4
+
+// checkSecretLeak returns an error when a secret value, as is or base64
+// encoded, is found outside the data or stringData of a Secret
+func checkSecretLeak(r *resource.Resource, secretValues map[string]string) error {
+	var leaks []string
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, field := range v {
+				fieldPath := key
+				if path != "" {
+					fieldPath = path + "." + key
+				}
+				if r.GetKind() == "Secret" && (fieldPath == "data" || fieldPath == "stringData") {
+					continue
+				}
+				walk(fieldPath, field)
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		case string:
+			for secret, name := range secretValues {
+				if len(secret) < minSecretLength {
+					continue
+				}
+				if strings.Contains(v, secret) ||
+					strings.Contains(v, base64.StdEncoding.EncodeToString([]byte(secret))) {
+					leaks = append(leaks, fmt.Sprintf("%s holds a value from secret dataSource %s", path, name))
+				}
+			}
+		}
+	}
+	walk("", r.Map())
+	if len(leaks) > 0 {
+		sort.Strings(leaks)
+		return fmt.Errorf("secret leak: %s", strings.Join(leaks, ", "))
+	}
+	return nil
+}
+
+func collectStrings(value interface{}, collect func(string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, field := range v {
+			collectStrings(field, collect)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectStrings(item, collect)
+		}
+	case string:
+		collect(v)
+	}
+}
+
+func resourceId(r *resource.Resource) string {
+	return r.GetKind() + "/" + r.GetName()
+}
@@ -0,0 +1,326 @@
+// Package helmchart is the HelmChart generator, it renders a helm chart into resources.
+package helmchart
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/command"
+	"github.com/qlik-trial/qliksense-config/pkg/fsutil"
+	"github.com/qlik-trial/qliksense-config/pkg/helm"
+	"github.com/qlik-trial/qliksense-config/pkg/values"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/yaml"
+)
+
+// Plugin is the HelmChart generator, configured from a HelmChart resource.
+type Plugin struct {
+	ChartName        string                 `json:"chartName,omitempty" yaml:"chartName,omitempty"`
+	ChartHome        string                 `json:"chartHome,omitempty" yaml:"chartHome,omitempty"`
+	ChartVersion     string                 `json:"chartVersion,omitempty" yaml:"chartVersion,omitempty"`
+	ChartRepo        string                 `json:"chartRepo,omitempty" yaml:"chartRepo,omitempty"`
+	ValuesFrom       string                 `json:"valuesFrom,omitempty" yaml:"valuesFrom,omitempty"`
+	Values           map[string]interface{} `json:"values,omitempty" yaml:"values,omitempty"`
+	HelmHome         string                 `json:"helmHome,omitempty" yaml:"helmHome,omitempty"`
+	HelmBin          string                 `json:"helmBin,omitempty" yaml:"helmBin,omitempty"`
+	ReleaseName      string                 `json:"releaseName,omitempty" yaml:"releaseName,omitempty"`
+	ReleaseNamespace string                 `json:"releaseNamespace,omitempty" yaml:"releaseNamespace,omitempty"`
+	ExtraArgs        string                 `json:"extraArgs,omitempty" yaml:"extraArgs,omitempty"`
+	ChartPatches     string                 `json:"chartPatches,omitempty" yaml:"chartPatches,omitempty"`
+	ldr              ifc.Loader
+	rf               *resmap.Factory
+}
+
+func (p *Plugin) Config(
+	ldr ifc.Loader, rf *resmap.Factory, c []byte) (err error) {
+	p.ldr = ldr
+	p.rf = rf
+	return yaml.Unmarshal(c, p)
+}
+
+func (p *Plugin) Generate() (resmap.ResMap, error) {
+
+	// make temp directory
+	dir, err := ioutil.TempDir("", "tempRoot")
+	if err != nil {
+		return nil, err
+	}
+	dir = path.Join(dir, "../")
+
+	if p.HelmHome == "" {
+		// make home for helm stuff
+		directory := fmt.Sprintf("%s/%s", dir, "dotHelm")
+		p.HelmHome = directory
+	}
+
+	if len(p.ChartHome) == 0 {
+		// make home for chart stuff
+		directory := fmt.Sprintf("%s/%s", dir, p.ChartName)
+		p.ChartHome = directory
+	}
+
+	if p.HelmBin == "" {
+		p.HelmBin = "helm"
+	}
+
+	if p.ChartRepo == "" {
+		p.ChartRepo = "https://kubernetes-charts.storage.googleapis.com"
+	}
+
+	if p.ReleaseName == "" {
+		p.ReleaseName = "release-name"
+	}
+
+	if p.ReleaseNamespace == "" {
+		p.ReleaseName = "default"
+	}
+
+	err = p.initHelm()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(p.ChartHome); os.IsNotExist(err) {
+		err = p.fetchHelm()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the chart home may be staged for other HelmCharts and later builds, the
+	// chart is changed in a copy of its own
+	workDir, err := ioutil.TempDir("", "helmchart")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+	chartHome := filepath.Join(workDir, filepath.Base(p.ChartHome))
+	if err := fsutil.CopyDir(p.ChartHome, chartHome); err != nil {
+		return nil, err
+	}
+	p.ChartHome = chartHome
+
+	err = deleteRequirements(p.ChartHome)
+	if err != nil {
+		return nil, err
+	}
+
+	templatedYaml, err := p.templateHelm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.ChartPatches) > 0 {
+		err := p.formatYaml()
+		if err != nil {
+			return nil, err
+		}
+		templatedYaml, err = p.applyPatches(templatedYaml)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.rf.NewResMapFromBytes(templatedYaml)
+}
+
+func deleteRequirements(dir string) error {
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	files, err := d.Readdir(-1)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.Mode().IsRegular() {
+			ext := filepath.Ext(file.Name())
+			name := file.Name()[0 : len(file.Name())-len(ext)]
+			if name == "requirements" {
+				err := os.Remove(dir + "/" + file.Name())
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) helm() helm.Helm {
+	return helm.Helm{Bin: p.HelmBin, Home: p.HelmHome}
+}
+
+func (p *Plugin) initHelm() error {
+	return p.helm().Init()
+}
+
+func (p *Plugin) fetchHelm() error {
+	err := p.helm().Fetch(p.ChartRepo, p.ChartName, p.ChartVersion, p.ChartHome)
+	if err != nil {
+		return err
+	}
+
+	fileLocation := fmt.Sprintf("%s/%s", p.ChartHome, p.ChartName)
+	tempFileLocation := fileLocation + "-temp"
+
+	err = os.Rename(fileLocation, tempFileLocation)
+	if err != nil {
+		return err
+	}
+
+	err = fsutil.CopyDir(fileLocation+"-temp", p.ChartHome)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(tempFileLocation)
+	if err != nil {
+		return err
+	}
+	return nil
+
+}
+
+func (p *Plugin) templateHelm() ([]byte, error) {
+
+	valuesYaml, err := yaml.Marshal(p.Values)
+	if err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile("", "yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	_, err = file.Write(valuesYaml)
+	if err != nil {
+		return nil, err
+	}
+
+	options := helm.TemplateOptions{
+		ReleaseName: p.ReleaseName,
+		Namespace:   p.ReleaseNamespace,
+		ValuesFiles: []string{file.Name()},
+	}
+	if len(p.ExtraArgs) > 0 && p.ExtraArgs != "null" {
+		options.ExtraArgs = append(options.ExtraArgs, p.ExtraArgs)
+	}
+	if len(p.ValuesFrom) > 0 && p.ValuesFrom != "null" {
+		options.ValuesFiles = append(options.ValuesFiles, p.ValuesFrom)
+	}
+	return p.helm().Template(p.ChartHome, options)
+}
+
+func (p *Plugin) formatYaml() error {
+	dir, err := os.Open(p.ChartHome + "/" + p.ChartPatches)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	objs, err := dir.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		filePath := filepath.Join(dir.Name(), obj)
+		if filepath.Ext(filePath) == ".yaml" {
+			var parsedString string
+			yamlBytes, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(p.ReleaseName, p.ChartName) {
+				parsedString = strings.Replace(string(yamlBytes), "?", "", -1)
+			} else {
+				parsedString = strings.Replace(string(yamlBytes), "?", p.ReleaseName+"-", -1)
+			}
+			parsedYaml := strings.Replace(parsedString, "*", p.ReleaseName+"-", -1)
+
+			err = ioutil.WriteFile(filePath, []byte(parsedYaml), 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) applyPatches(templatedHelm []byte) ([]byte, error) {
+	// get the patches
+	path := filepath.Join(p.ChartHome + "/" + p.ChartPatches + "/kustomization.yaml")
+	origYamlBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var originalYamlMap map[string]interface{}
+
+	yaml.Unmarshal(origYamlBytes, &originalYamlMap)
+	patches := originalYamlMap["patchesJson6902"]
+	patchArray := patches.([]interface{})
+
+	// helmoutput file for kustomize build
+	f, err := os.Create(p.ChartHome + "/" + p.ChartPatches + "/helmoutput.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	// loop through all patches
+	for _, patch := range patchArray {
+
+		_, err = f.Write(templatedHelm)
+		if err != nil {
+			return nil, err
+		}
+
+		kustomizeYaml, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var kustomizeYamlMap map[string]interface{}
+		yaml.Unmarshal(kustomizeYaml, &kustomizeYamlMap)
+
+		// delete old resources in map
+		delete(kustomizeYamlMap, "patchesJson6902")
+		delete(kustomizeYamlMap, "resources")
+
+		//merge patch data together
+		mergedData := values.MergeValue(kustomizeYamlMap["patchesJson6902"], patch)
+
+		// update yaml
+		kustomizeYamlMap["patchesJson6902"] = []interface{}{mergedData}
+		kustomizeYamlMap["resources"] = []string{"helmoutput.yaml"}
+
+		yamlM, err := yaml.Marshal(kustomizeYamlMap)
+		if err != nil {
+			return nil, err
+		}
+
+		ioutil.WriteFile(path, yamlM, 0644)
+		// kustomize build
+		templatedHelm, err = p.buildPatches()
+		if err != nil {
+			return nil, err
+		}
+
+	}
+	return templatedHelm, nil
+}
+
+func (p *Plugin) buildPatches() ([]byte, error) {
+	path := filepath.Join(p.ChartHome + "/" + p.ChartPatches)
+	return command.Run("", "kustomize", "build", path)
+}
@@ -0,0 +1,110 @@
+// Package helmvalues is the HelmValues transformer, it merges values, release names and namespaces into HelmCharts.
+package helmvalues
+
+import (
+	"github.com/qlik-trial/qliksense-config/pkg/values"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/transformers"
+	"sigs.k8s.io/kustomize/v3/pkg/transformers/config"
+	"sigs.k8s.io/yaml"
+)
+
+// Plugin is the HelmValues transformer, configured from a HelmValues resource.
+type Plugin struct {
+	Overwrite        bool                   `json:"overwrite,omitempty" yaml:"overwrite,omitempty"`
+	Chart            string                 `json:"chartName,omitempty" yaml:"chartName,omitempty"`
+	ReleaseName      string                 `json:"releaseName,omitempty" yaml:"releaseName,omitempty"`
+	ReleaseNamespace string                 `json:"releaseNamespace,omitempty" yaml:"releaseNamespace,omitempty"`
+	FieldSpecs       []config.FieldSpec     `json:"fieldSpecs,omitempty" yaml:"fieldSpecs,omitempty"`
+	Values           map[string]interface{} `json:"values,omitempty" yaml:"values,omitempty"`
+	ValuesName       string
+}
+
+func (p *Plugin) Config(
+	ldr ifc.Loader, rf *resmap.Factory, c []byte) (err error) {
+	return yaml.Unmarshal(c, p)
+}
+
+func (p *Plugin) mutateReleaseNameSpace(in interface{}) (interface{}, error) {
+	return p.ReleaseNamespace, nil
+}
+
+func (p *Plugin) mutateReleaseName(in interface{}) (interface{}, error) {
+	return p.ReleaseName, nil
+}
+
+func (p *Plugin) mutateValues(in interface{}) (interface{}, error) {
+	// merge the new values into whats already in the document stream
+	if p.ValuesName != "" {
+		return values.MergeLegacy(in, p.Values[p.ValuesName], p.Overwrite)
+	}
+	return values.MergeLegacy(in, p.Values, p.Overwrite)
+}
+
+func (p *Plugin) Transform(m resmap.ResMap) error {
+	for _, r := range m.Resources() {
+		if isHelmChart(r) {
+			if applyResources(r, p.Chart) {
+				err := transformers.MutateField(
+					r.Map(),
+					[]string{"values"},
+					true,
+					p.mutateValues)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		name, _ := r.GetString("chartName")
+		if p.Values[name] != nil && p.Values[name] != "null" {
+			p.ValuesName = name
+			err := transformers.MutateField(
+				r.Map(),
+				[]string{"values", name},
+				true,
+				p.mutateValues)
+			if err != nil {
+				return err
+			}
+			p.ValuesName = ""
+		}
+		if len(p.ReleaseNamespace) > 0 && p.ReleaseNamespace != "null" {
+			err := transformers.MutateField(
+				r.Map(),
+				[]string{"releaseNamespace"},
+				true,
+				p.mutateReleaseNameSpace)
+			if err != nil {
+				return err
+			}
+		}
+		if len(p.ReleaseName) > 0 && p.ReleaseName != "null" {
+			err := transformers.MutateField(
+				r.Map(),
+				[]string{"releaseName"},
+				true,
+				p.mutateReleaseName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isHelmChart(obj ifc.Kunstructured) bool {
+	kind := obj.GetKind()
+	if kind == "HelmChart" {
+		return true
+	}
+	return false
+}
+
+func applyResources(obj ifc.Kunstructured, chart string) bool {
+	name, _ := obj.GetString("chartName")
+	if name == chart || chart == "" || chart == "null" {
+		return true
+	}
+	return false
+}
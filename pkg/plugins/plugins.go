@@ -0,0 +1,87 @@
+// Package plugins creates the qlik.com/v1 plugins by kind, so that they can
+// run in-process outside of kustomize's Go plugin loader.
+package plugins
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/qlik-trial/qliksense-config/pkg/plugins/charthomefullpath"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins/gomplate"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins/helmchart"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins/helmvalues"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins/selectivepatch"
+	"github.com/qlik-trial/qliksense-config/pkg/plugins/valuesfile"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/validator"
+	"sigs.k8s.io/kustomize/v3/pkg/fs"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/loader"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+)
+
+// APIVersion is the apiVersion of the plugin configs
+const APIVersion = "qlik.com/v1"
+
+// Plugin is a plugin that is configured before it generates or transforms,
+// as kustomize's Go plugins are
+type Plugin interface {
+	Config(ldr ifc.Loader, rf *resmap.Factory, config []byte) error
+}
+
+var kinds = map[string]func() Plugin{
+	"ChartHomeFullPath": func() Plugin { return &charthomefullpath.Plugin{} },
+	"Gomplate":          func() Plugin { return &gomplate.Plugin{} },
+	"HelmChart":         func() Plugin { return &helmchart.Plugin{} },
+	"HelmValues":        func() Plugin { return &helmvalues.Plugin{} },
+	"SelectivePatch":    func() Plugin { return &selectivepatch.Plugin{} },
+	"ValuesFile":        func() Plugin { return &valuesfile.Plugin{} },
+}
+
+// New returns a new, unconfigured plugin of the kind. It is a
+// transformers.Generator or a transformers.Transformer.
+func New(kind string) (Plugin, error) {
+	newPlugin, ok := kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown plugin kind %q, expected one of %v", kind, Kinds())
+	}
+	return newPlugin(), nil
+}
+
+// Kinds returns the plugin kinds in order.
+func Kinds() []string {
+	var result []string
+	for kind := range kinds {
+		result = append(result, kind)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// NewFactory returns the resmap factory kustomize itself uses.
+func NewFactory() *resmap.Factory {
+	return resmap.NewFactory(
+		resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl()),
+		transformer.NewFactoryImpl())
+}
+
+// LoadRestrictor returns kustomize's --load_restrictor of the name, rootOnly,
+// the default, or none.
+func LoadRestrictor(name string) (loader.LoadRestrictorFunc, error) {
+	switch name {
+	case "", "rootOnly":
+		return loader.RestrictionRootOnly, nil
+	case "none":
+		return loader.RestrictionNone, nil
+	default:
+		return nil, fmt.Errorf("unknown load restrictor %q, expected rootOnly or none", name)
+	}
+}
+
+// NewLoader returns a loader rooted at root on disk, root may be a remote
+// git base. lr restricts the files it loads as kustomize's --load_restrictor.
+func NewLoader(lr loader.LoadRestrictorFunc, root string) (ifc.Loader, error) {
+	return loader.NewLoader(lr, validator.NewKustValidator(), root, fs.MakeRealFS())
+}
@@ -0,0 +1,726 @@
+// Package selectivepatch is the SelectivePatch transformer, it applies lists of patches and injections to selected resources.
+package selectivepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"github.com/qlik-trial/qliksense-config/pkg/selectors"
+	"github.com/qlik-trial/qliksense-config/pkg/values"
+	"sigs.k8s.io/kustomize/v3/pkg/gvk"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// patch is a single entry of the patches list, either loaded
+// from a file (path) or given inline (patch)
+type patch struct {
+	Path   string    `json:"path,omitempty" yaml:"path,omitempty"`
+	Patch  string    `json:"patch,omitempty" yaml:"patch,omitempty"`
+	Target *selector `json:"target,omitempty" yaml:"target,omitempty"`
+	Inject *inject   `json:"inject,omitempty" yaml:"inject,omitempty"`
+	Expect *expect   `json:"expect,omitempty" yaml:"expect,omitempty"`
+	// Type is one of strategicMerge, json6902 or jsonMerge,
+	// when empty strategic merge then JSON6902 are tried
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Vars are merged over the document vars, when any are set the
+	// patch is rendered as a template before it is parsed
+	Vars                map[string]interface{} `json:"vars,omitempty" yaml:"vars,omitempty"`
+	strategicMergePatch *resource.Resource
+	json6902Patch       jsonpatch.Patch
+	jsonMergePatch      []byte
+	jsonMergeIdentity   *resource.Resource
+}
+
+const (
+	strategicMergeType = "strategicMerge"
+	json6902Type       = "json6902"
+	jsonMergeType      = "jsonMerge"
+)
+
+// selector extends the kustomize selector, whose name and namespace
+// are unanchored regexes, with globs, chart provenance and exclusions
+type selector struct {
+	types.Selector `json:",inline" yaml:",inline"`
+	// NameGlob matches the resource name with shell glob syntax, e.g. *-redis
+	NameGlob string `json:"nameGlob,omitempty" yaml:"nameGlob,omitempty"`
+	// Chart matches resources rendered from the named chart by their
+	// helm.sh/chart or chart label, or annotation when the chart has no such
+	// label, with or without the chart version
+	Chart string `json:"chart,omitempty" yaml:"chart,omitempty"`
+	// Exclude removes resources matching any of these selectors
+	Exclude []*selector `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// chartLabels are the labels helm charts use to record their provenance,
+// some charts set them as annotations instead
+var chartLabels = []string{"helm.sh/chart", "chart"}
+
+// expect bounds how many resources a patch target must match,
+// to catch selectors that drift from the charts they patch
+type expect struct {
+	Min *int `json:"min,omitempty" yaml:"min,omitempty"`
+	Max *int `json:"max,omitempty" yaml:"max,omitempty"`
+}
+
+// inject adds env, envFrom and volumeMounts to the containers of matched
+// workloads, and volumes to their pod spec, without naming the containers
+type inject struct {
+	// ContainerName is a regex on container names, all containers
+	// are injected when neither ContainerName or ContainerIndex are set
+	ContainerName  string        `json:"containerName,omitempty" yaml:"containerName,omitempty"`
+	ContainerIndex *int          `json:"containerIndex,omitempty" yaml:"containerIndex,omitempty"`
+	Env            []interface{} `json:"env,omitempty" yaml:"env,omitempty"`
+	EnvFrom        []interface{} `json:"envFrom,omitempty" yaml:"envFrom,omitempty"`
+	VolumeMounts   []interface{} `json:"volumeMounts,omitempty" yaml:"volumeMounts,omitempty"`
+	Volumes        []interface{} `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	containerName  *regexp.Regexp
+}
+
+// podSpecPaths are where the pod spec lives for each supported workload kind
+var podSpecPaths = map[string][]string{
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// enabledWhen enables the patches from a condition on HelmValues,
+// e.g. "global.mongodb.external == true"
+type enabledWhen struct {
+	// Values is a path to a file holding one or more HelmValues documents,
+	// later documents take precedence over earlier ones
+	Values    string `json:"values,omitempty" yaml:"values,omitempty"`
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+}
+
+type metadata struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// Plugin is the SelectivePatch transformer, configured from a SelectivePatch resource.
+type Plugin struct {
+	Metadata    metadata     `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Enabled     bool         `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	EnabledWhen *enabledWhen `json:"enabledWhen,omitempty" yaml:"enabledWhen,omitempty"`
+	Path        string       `json:"path,omitempty" yaml:"path,omitempty"`
+	Target      *selector    `json:"target,omitempty" yaml:"target,omitempty"`
+	Patches     []*patch     `json:"patches,omitempty" yaml:"patches,omitempty"`
+	// Vars are available to every patch template
+	Vars map[string]interface{} `json:"vars,omitempty" yaml:"vars,omitempty"`
+	// Report lists the resources changed by each patch on stderr,
+	// DryRun does the same without keeping the changes
+	Report bool `json:"report,omitempty" yaml:"report,omitempty"`
+	DryRun bool `json:"dryRun,omitempty" yaml:"dryRun,omitempty"`
+	ldr    ifc.Loader
+	rf     *resmap.Factory
+}
+
+// placeholderNames are patch names that stand for every
+// resource of the patch kind rather than a resource of that name
+var placeholderNames = []string{"component", "*"}
+
+func (p *Plugin) Config(
+	ldr ifc.Loader, rf *resmap.Factory, c []byte) error {
+	p.ldr = ldr
+	p.rf = rf
+	err := yaml.Unmarshal(c, p)
+	if err != nil {
+		return err
+	}
+
+	// enabledWhen takes precedence over the literal enabled flag
+	if p.EnabledWhen != nil {
+		p.Enabled, err = p.evaluateEnabledWhen()
+		if err != nil {
+			return errors.Wrap(err, "enabledWhen")
+		}
+	}
+
+	// the single path/target form is kept for backward compatibility
+	// and is applied before the patches list
+	if p.Path != "" || p.Target != nil {
+		p.Patches = append([]*patch{{Path: p.Path, Target: p.Target}}, p.Patches...)
+	}
+
+	for i, pt := range p.Patches {
+		err := p.loadPatch(pt)
+		if err != nil {
+			return errors.Wrapf(err, "patches[%d]", i)
+		}
+		if pt.Target != nil {
+			if err := pt.Target.validate(); err != nil {
+				return errors.Wrapf(err, "patches[%d].target", i)
+			}
+		}
+		// such a patch would never match anything, whatever it expects
+		if pt.Target == nil && pt.defaultTarget() == nil {
+			return fmt.Errorf("patches[%d]: no target is set and the patch names no resource to default it from", i)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) loadPatch(pt *patch) error {
+	if pt.Inject != nil && pt.Inject.ContainerName != "" {
+		var err error
+		pt.Inject.containerName, err = regexp.Compile(pt.Inject.ContainerName)
+		if err != nil {
+			return errors.Wrap(err, "inject.containerName")
+		}
+	}
+	if pt.Path != "" && pt.Patch != "" {
+		return errors.New("only one of path or patch can be set")
+	}
+	var content []byte
+	if pt.Patch != "" {
+		content = []byte(pt.Patch)
+	} else if pt.Path != "" {
+		loadPath := filepath.Join(p.ldr.Root(), pt.Path)
+		//load the patch
+		var err error
+		content, err = p.ldr.Load(loadPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		return nil
+	}
+
+	vars := map[string]interface{}{}
+	for k, v := range p.Vars {
+		vars[k] = v
+	}
+	for k, v := range pt.Vars {
+		vars[k] = v
+	}
+	if len(vars) > 0 {
+		var err error
+		content, err = renderTemplate(content, vars)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch pt.Type {
+	case strategicMergeType:
+		pt.strategicMergePatch, err = p.rf.RF().FromBytes(content)
+		return err
+	case json6902Type:
+		pt.json6902Patch, err = jsonPatchFromBytes(content)
+		return err
+	case jsonMergeType:
+		pt.jsonMergePatch, err = yaml.YAMLToJSON(content)
+		if err != nil {
+			return err
+		}
+		// the identity is optional, it is only used to default the target
+		pt.jsonMergeIdentity, _ = p.rf.RF().FromBytes(content)
+		return nil
+	case "":
+	default:
+		return fmt.Errorf("unknown patch type %q, expected one of %s, %s or %s",
+			pt.Type, strategicMergeType, json6902Type, jsonMergeType)
+	}
+
+	pt.strategicMergePatch, err = p.rf.RF().FromBytes(content)
+	if err == nil {
+		return nil
+	}
+	pt.json6902Patch, err = jsonPatchFromBytes(content)
+	if err == nil {
+		return nil
+	}
+	return errors.New("neither a strategic Merge patch or JSON6902 patch was Found")
+}
+
+// renderTemplate executes a patch template with (( )) delimiters,
+// matching the delimiters used by the gomplate transformer
+func renderTemplate(content []byte, vars map[string]interface{}) ([]byte, error) {
+	tmpl, err := template.New("patch").
+		Delims("((", "))").
+		Option("missingkey=error").
+		Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, vars)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// evaluateEnabledWhen looks up the condition path under values of the
+// referenced HelmValues documents, a bare path is true when the value
+// is set and neither false nor empty
+func (p *Plugin) evaluateEnabledWhen() (bool, error) {
+	if p.EnabledWhen.Values == "" || p.EnabledWhen.Condition == "" {
+		return false, errors.New("both values and condition must be set")
+	}
+	content, err := p.ldr.Load(filepath.Join(p.ldr.Root(), p.EnabledWhen.Values))
+	if err != nil {
+		return false, err
+	}
+	docs, err := p.rf.RF().SliceFromBytes(content)
+	if err != nil {
+		return false, err
+	}
+
+	fieldPath, operator, expected := parseCondition(p.EnabledWhen.Condition)
+	var actual interface{}
+	for _, doc := range docs {
+		if doc.GetKind() != "HelmValues" {
+			continue
+		}
+		value, err := doc.GetFieldValue("values." + fieldPath)
+		if err == nil {
+			actual = value
+		}
+	}
+
+	switch operator {
+	case "==":
+		return fmt.Sprintf("%v", actual) == fmt.Sprintf("%v", expected), nil
+	case "!=":
+		return fmt.Sprintf("%v", actual) != fmt.Sprintf("%v", expected), nil
+	}
+	return actual != nil && actual != false && actual != "", nil
+}
+
+// parseCondition splits "path == value" into its parts, the value
+// is read as YAML so booleans, numbers and quoted strings all work
+func parseCondition(condition string) (string, string, interface{}) {
+	for _, operator := range []string{"==", "!="} {
+		parts := strings.SplitN(condition, operator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		var expected interface{}
+		err := yaml.Unmarshal([]byte(strings.TrimSpace(parts[1])), &expected)
+		if err != nil {
+			expected = strings.TrimSpace(parts[1])
+		}
+		return strings.TrimSpace(parts[0]), operator, expected
+	}
+	return strings.TrimSpace(condition), "", nil
+}
+
+func (p *Plugin) Transform(m resmap.ResMap) error {
+
+	if !p.Enabled {
+		return nil
+	}
+
+	// patches are applied in declaration order
+	for i, pt := range p.Patches {
+		changed, err := pt.apply(m, p.DryRun)
+		if err != nil {
+			return errors.Wrapf(err, "SelectivePatch %s patches[%d]", p.Metadata.Name, i)
+		}
+		if p.Report || p.DryRun {
+			fmt.Fprintf(os.Stderr, "SelectivePatch %s patches[%d]: %d changed %v\n",
+				p.Metadata.Name, i, len(changed), changed)
+		}
+	}
+	return nil
+}
+
+// apply patches the resources matched by the patch target and returns
+// the ids of the resources that were changed, in dry run mode the
+// resources are restored after patching
+func (pt *patch) apply(m resmap.ResMap, dryRun bool) ([]string, error) {
+	target := pt.Target
+	if target == nil {
+		target = pt.defaultTarget()
+	}
+	resources, err := target.selectFrom(m)
+	if err != nil {
+		return nil, err
+	}
+	if pt.Target == nil && pt.strategicMergePatch == nil && pt.jsonMergeIdentity == nil && pt.Inject != nil {
+		resources = workloads(resources)
+	}
+	err = pt.Expect.check(len(resources))
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, r := range resources {
+		origObj, err := r.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		err = pt.applyTo(r)
+		if err != nil {
+			return nil, errors.Wrap(err, resourceId(r))
+		}
+		patchedObj, err := r.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if string(origObj) != string(patchedObj) {
+			changed = append(changed, resourceId(r))
+		}
+		if dryRun {
+			err = r.UnmarshalJSON(origObj)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+func (pt *patch) applyTo(r *resource.Resource) error {
+	if pt.json6902Patch != nil {
+		obj, err := r.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		// ops are applied one at a time to report which one failed
+		for i, op := range pt.json6902Patch {
+			obj, err = jsonpatch.Patch{op}.Apply(obj)
+			if err != nil {
+				path, _ := op.Path()
+				return errors.Wrapf(err, "op %d (%s %s)", i, op.Kind(), path)
+			}
+		}
+		err = r.UnmarshalJSON(obj)
+		if err != nil {
+			return err
+		}
+	}
+	if pt.jsonMergePatch != nil {
+		obj, err := r.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		mergePatch, err := withoutIdentity(pt.jsonMergePatch)
+		if err != nil {
+			return err
+		}
+		obj, err = jsonpatch.MergePatch(obj, mergePatch)
+		if err != nil {
+			return err
+		}
+		err = r.UnmarshalJSON(obj)
+		if err != nil {
+			return err
+		}
+	}
+	if pt.strategicMergePatch != nil {
+		patchCopy := pt.strategicMergePatch.DeepCopy()
+		// the patch may be selected by target or placeholder name,
+		// so it must take on the identity of the patched resource
+		patchCopy.SetName(r.GetName())
+		patchCopy.SetGvk(r.GetGvk())
+		err := r.Patch(patchCopy.Kunstructured)
+		if err != nil {
+			return err
+		}
+	}
+	if pt.Inject != nil {
+		return pt.Inject.apply(r)
+	}
+	return nil
+}
+
+// validate fails on a name or namespace that is not a regex, which kustomize
+// panics on, and on a nameGlob that is not a glob, here or in the exclusions
+func (s *selector) validate() error {
+	if err := selectors.Validate(s.Selector); err != nil {
+		return err
+	}
+	if _, err := filepath.Match(s.NameGlob, ""); err != nil {
+		return errors.Wrap(err, "nameGlob")
+	}
+	for i, exclude := range s.Exclude {
+		if err := exclude.validate(); err != nil {
+			return errors.Wrapf(err, "exclude[%d]", i)
+		}
+	}
+	return nil
+}
+
+// selectFrom returns the resources matched by the selector
+func (s *selector) selectFrom(m resmap.ResMap) ([]*resource.Resource, error) {
+	resources, err := m.Select(s.Selector)
+	if err != nil {
+		return nil, err
+	}
+	excluded := map[*resource.Resource]bool{}
+	for _, exclude := range s.Exclude {
+		matches, err := exclude.selectFrom(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range matches {
+			excluded[r] = true
+		}
+	}
+
+	var result []*resource.Resource
+	for _, r := range resources {
+		if excluded[r] {
+			continue
+		}
+		if s.NameGlob != "" {
+			matched, err := filepath.Match(s.NameGlob, r.GetName())
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		if s.Chart != "" && !fromChart(r, s.Chart) {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// fromChart is true when a chart label, or else a chart annotation, names
+// the chart, either alone or followed by a dash and the chart version
+func fromChart(r *resource.Resource, chart string) bool {
+	for _, provenance := range []map[string]string{r.GetLabels(), r.GetAnnotations()} {
+		found := false
+		for _, key := range chartLabels {
+			value, ok := provenance[key]
+			if ok && namesChart(value, chart) {
+				return true
+			}
+			found = found || ok
+		}
+		if found {
+			return false
+		}
+	}
+	return false
+}
+
+func namesChart(value string, chart string) bool {
+	if value == chart {
+		return true
+	}
+	version := strings.TrimPrefix(value, chart+"-")
+	return version != value && version != "" && version[0] >= '0' && version[0] <= '9'
+}
+
+// check fails when the number of matched resources is out of bounds
+func (e *expect) check(matched int) error {
+	if e == nil {
+		return nil
+	}
+	if e.Min != nil && matched < *e.Min {
+		return fmt.Errorf("expected at least %d matching resources, found %d", *e.Min, matched)
+	}
+	if e.Max != nil && matched > *e.Max {
+		return fmt.Errorf("expected at most %d matching resources, found %d", *e.Max, matched)
+	}
+	return nil
+}
+
+// withoutIdentity drops apiVersion, kind and metadata.name from a JSON
+// merge patch so that it can be applied to any selected resource
+func withoutIdentity(mergePatch []byte) ([]byte, error) {
+	var obj map[string]interface{}
+	err := json.Unmarshal(mergePatch, &obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(obj, "apiVersion")
+	delete(obj, "kind")
+	if meta, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(meta, "name")
+		if len(meta) == 0 {
+			delete(obj, "metadata")
+		}
+	}
+	return json.Marshal(obj)
+}
+
+func workloads(resources []*resource.Resource) []*resource.Resource {
+	var result []*resource.Resource
+	for _, r := range resources {
+		if _, ok := podSpecPaths[r.GetKind()]; ok {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func resourceId(r *resource.Resource) string {
+	id := r.GetKind() + "/" + r.GetName()
+	if r.GetNamespace() != "" {
+		id = r.GetNamespace() + "/" + id
+	}
+	return id
+}
+
+// defaultTarget builds a selector from the patch's own
+// GVK and name, falling back to every resource of the patch kind when
+// the patch uses a placeholder name
+func (pt *patch) defaultTarget() *selector {
+	identity := pt.strategicMergePatch
+	if identity == nil {
+		identity = pt.jsonMergeIdentity
+	}
+	if identity == nil {
+		if pt.Inject != nil {
+			// every resource, those without a pod spec are skipped
+			return &selector{}
+		}
+		return nil
+	}
+	patchGvk := identity.GetGvk()
+	name := identity.GetName()
+	for _, placeholder := range placeholderNames {
+		if name == placeholder {
+			return &selector{Selector: types.Selector{Gvk: gvk.Gvk{Kind: patchGvk.Kind}}}
+		}
+	}
+	return &selector{Selector: types.Selector{
+		Gvk:  patchGvk,
+		Name: "^" + regexp.QuoteMeta(name) + "$",
+	}}
+}
+
+// apply injects into the pod spec of a workload, entries replace existing
+// ones with the same name so injecting is idempotent
+func (in *inject) apply(r *resource.Resource) error {
+	path, ok := podSpecPaths[r.GetKind()]
+	if !ok {
+		return nil
+	}
+	obj := r.Map()
+	podSpec, ok := nestedMap(obj, path)
+	if !ok {
+		return nil
+	}
+
+	containers, _ := podSpec["containers"].([]interface{})
+	for i, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok || !in.matches(i, container) {
+			continue
+		}
+		container["env"] = mergeNamed(container["env"], in.Env, "name")
+		container["envFrom"] = mergeNamed(container["envFrom"], in.EnvFrom, "")
+		container["volumeMounts"] = mergeNamed(container["volumeMounts"], in.VolumeMounts, "mountPath")
+		removeEmpty(container, "env", "envFrom", "volumeMounts")
+	}
+	podSpec["volumes"] = mergeNamed(podSpec["volumes"], in.Volumes, "name")
+	removeEmpty(podSpec, "volumes")
+
+	r.SetMap(obj)
+	return nil
+}
+
+func (in *inject) matches(index int, container map[string]interface{}) bool {
+	if in.ContainerIndex != nil && *in.ContainerIndex != index {
+		return false
+	}
+	if in.containerName != nil {
+		name, _ := container["name"].(string)
+		return in.containerName.MatchString(name)
+	}
+	return true
+}
+
+func nestedMap(obj map[string]interface{}, path []string) (map[string]interface{}, bool) {
+	current := obj
+	for _, field := range path {
+		next, ok := current[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// mergeNamed appends copies of additions to existing, replacing entries
+// that share the same key field, or identical entries when key is empty
+func mergeNamed(existing interface{}, additions []interface{}, key string) []interface{} {
+	result, _ := existing.([]interface{})
+	for _, addition := range additions {
+		addition = deepCopy(addition)
+		replaced := false
+		for i, entry := range result {
+			if sameEntry(entry, addition, key) {
+				result[i] = addition
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, addition)
+		}
+	}
+	return result
+}
+
+// sameEntry compares the key fields of the entries, or the whole entries
+// when key is empty, deeply as either may hold maps and lists
+func sameEntry(a, b interface{}, key string) bool {
+	if key == "" {
+		return reflect.DeepEqual(a, b)
+	}
+	aMap, aOk := a.(map[string]interface{})
+	bMap, bOk := b.(map[string]interface{})
+	return aOk && bOk && aMap[key] != nil && reflect.DeepEqual(aMap[key], bMap[key])
+}
+
+func removeEmpty(obj map[string]interface{}, fields ...string) {
+	for _, field := range fields {
+		if list, ok := obj[field].([]interface{}); ok && len(list) == 0 {
+			delete(obj, field)
+		}
+	}
+}
+
+func deepCopy(in interface{}) interface{} {
+	var out interface{}
+	if values.DeepCopy(in, &out) != nil {
+		return in
+	}
+	return out
+}
+
+// jsonPatchFromBytes loads a Json 6902 patch from
+// a bytes input
+func jsonPatchFromBytes(in []byte) (jsonpatch.Patch, error) {
+	ops := string(in)
+	if ops == "" {
+		return nil, fmt.Errorf("empty json patch operations")
+	}
+
+	if ops[0] != '[' {
+		jsonOps, err := yaml.YAMLToJSON(in)
+		if err != nil {
+			return nil, err
+		}
+		ops = string(jsonOps)
+	}
+	return jsonpatch.DecodePatch([]byte(ops))
+}
@@ -0,0 +1,206 @@
+// Package valuesfile is the ValuesFile transformer, it merges a values file into the values of HelmCharts and HelmValues.
+package valuesfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/qlik-trial/qliksense-config/pkg/gomplate"
+	"github.com/qlik-trial/qliksense-config/pkg/secrets"
+	"github.com/qlik-trial/qliksense-config/pkg/selectors"
+	"github.com/qlik-trial/qliksense-config/pkg/values"
+	"sigs.k8s.io/kustomize/v3/pkg/ifc"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultKinds are the kinds whose values are merged when no target is set
+var defaultKinds = []string{"HelmChart", "HelmValues"}
+
+const (
+	filePrecedence     = "file"
+	resourcePrecedence = "resource"
+)
+
+// documentSeparator splits a values file into its documents
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// valuesDocument is a document of the values file, a HelmValues style
+// document with a name only applies to the chart of that name, any other
+// document is values for every target
+type valuesDocument struct {
+	name   string
+	values map[string]interface{}
+}
+
+// Plugin is the ValuesFile transformer, configured from a ValuesFile resource.
+type Plugin struct {
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// DataSource is optional, the values file is templated with it as data
+	DataSource secrets.DataSource `json:"dataSource,omitempty" yaml:"dataSource,omitempty"`
+	ValuesFile string             `json:"valuesFile,omitempty" yaml:"valuesFile,omitempty"`
+	// Target selects the resources to merge the values into, HelmChart and
+	// HelmValues resources by default
+	Target *types.Selector `json:"target,omitempty" yaml:"target,omitempty"`
+	// Precedence is file, the default, for the values file to win over the
+	// values of the resource or resource for the other way around
+	Precedence string `json:"precedence,omitempty" yaml:"precedence,omitempty"`
+	ldr        ifc.Loader
+	rf         *resmap.Factory
+}
+
+func (p *Plugin) Config(
+	ldr ifc.Loader, rf *resmap.Factory, c []byte) (err error) {
+	p.ldr = ldr
+	p.rf = rf
+	err = yaml.Unmarshal(c, p)
+	if err != nil {
+		return err
+	}
+	if p.ValuesFile == "" {
+		return fmt.Errorf("valuesFile is not set")
+	}
+	if p.Target != nil {
+		if err := selectors.Validate(*p.Target); err != nil {
+			return fmt.Errorf("target: %v", err)
+		}
+	}
+	switch p.Precedence {
+	case "":
+		p.Precedence = filePrecedence
+	case filePrecedence, resourcePrecedence:
+	default:
+		return fmt.Errorf("unknown precedence %q, expected %s or %s", p.Precedence, filePrecedence, resourcePrecedence)
+	}
+	return nil
+}
+
+func (p *Plugin) Transform(m resmap.ResMap) error {
+	if !p.Enabled {
+		return nil
+	}
+	resources, err := p.targets(m)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+
+	documents, err := p.renderValues()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		for _, document := range documents {
+			if document.name != "" && !chartMatches(r, document.name) {
+				continue
+			}
+			// every resource gets its own copy, merging shares nested maps
+			var copied map[string]interface{}
+			if err := values.DeepCopy(document.values, &copied); err != nil {
+				return err
+			}
+			obj := r.Map()
+			merged, _ := obj["values"].(map[string]interface{})
+			if p.Precedence == resourcePrecedence {
+				merged = values.Merge(copied, merged)
+			} else {
+				merged = values.Merge(merged, copied)
+			}
+			if len(merged) == 0 {
+				delete(obj, "values")
+			} else {
+				obj["values"] = merged
+			}
+			r.SetMap(obj)
+		}
+	}
+
+	return nil
+}
+
+// chartMatches reports whether the resource is the chart called name, by
+// its chartName or its own name
+func chartMatches(r *resource.Resource, name string) bool {
+	if r.GetName() == name {
+		return true
+	}
+	chartName, err := r.GetFieldValue("chartName")
+	return err == nil && chartName == name
+}
+
+// renderValues templates the values file with the datasource, once per
+// build, and splits it into its documents
+func (p *Plugin) renderValues() ([]valuesDocument, error) {
+	// the loader is rooted at the kustomization of this config, which is
+	// the cloned repository when it comes from a remote base
+	output, err := p.ldr.Load(p.ValuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("values file %s is not found: %v", p.ValuesFile, err)
+	}
+
+	// the values file is only a template when there is data for it
+	if p.DataSource != (secrets.DataSource{}) {
+		source, err := p.DataSource.Source(p.ldr)
+		if err != nil {
+			return nil, err
+		}
+		data, err := source.Read()
+		if err != nil {
+			return nil, err
+		}
+		output, err = gomplate.Render(p.ValuesFile, string(output), map[string]interface{}{"data": data})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var documents []valuesDocument
+	for i, content := range documentSeparator.Split(string(output), -1) {
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		var values map[string]interface{}
+		err = yaml.Unmarshal([]byte(content), &values)
+		if err != nil {
+			return nil, fmt.Errorf("values file %s document %d: %v", p.ValuesFile, i, err)
+		}
+		if values == nil {
+			continue
+		}
+		documents = append(documents, newValuesDocument(values))
+	}
+	return documents, nil
+}
+
+func newValuesDocument(values map[string]interface{}) valuesDocument {
+	if kind, _ := values["kind"].(string); kind != "HelmValues" {
+		return valuesDocument{values: values}
+	}
+	document := valuesDocument{}
+	if metadata, ok := values["metadata"].(map[string]interface{}); ok {
+		document.name, _ = metadata["name"].(string)
+	}
+	document.values, _ = values["values"].(map[string]interface{})
+	return document
+}
+
+func (p *Plugin) targets(m resmap.ResMap) ([]*resource.Resource, error) {
+	if p.Target != nil {
+		return m.Select(*p.Target)
+	}
+	var resources []*resource.Resource
+	for _, r := range m.Resources() {
+		for _, kind := range defaultKinds {
+			if r.GetKind() == kind {
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources, nil
+}
@@ -0,0 +1,154 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// EjsonSource decrypts an ejson file. The private key is read from
+// PrivateKeyPath when that file exists, otherwise from EJSON_KEY.
+type EjsonSource struct {
+	FilePath       string `json:"filePath,omitempty" yaml:"filePath,omitempty"`
+	PrivateKeyPath string `json:"privateKeyPath,omitempty" yaml:"privateKeyPath,omitempty"`
+	ldr            Loader
+}
+
+// ejsonValue matches an ejson encrypted value, EJ[1:pubkey:nonce:box]
+var ejsonValue = regexp.MustCompile(`^EJ\[1:([A-Za-z0-9+=/]{44}):([A-Za-z0-9+=/]{32}):(.+)\]$`)
+
+func (s *EjsonSource) withLoader(ldr Loader) *EjsonSource {
+	c := *s
+	c.ldr = ldr
+	return &c
+}
+
+func (s *EjsonSource) privateKey() (string, error) {
+	if s.PrivateKeyPath != "" {
+		if _, err := os.Stat(s.PrivateKeyPath); err == nil {
+			content, err := ioutil.ReadFile(s.PrivateKeyPath)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+	return strings.TrimSpace(os.Getenv("EJSON_KEY")), nil
+}
+
+func (s *EjsonSource) hasKey() bool {
+	key, err := s.privateKey()
+	return err == nil && key != ""
+}
+
+// Read decrypts every value of the ejson file, keys starting with an
+// underscore are never encrypted and are returned as they are.
+func (s *EjsonSource) Read() (interface{}, error) {
+	content, err := load(s.ldr, s.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.FilePath, err)
+	}
+
+	privateKey, err := s.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := hex.DecodeString(privateKey)
+	if err != nil || len(keyBytes) != 32 {
+		return nil, errors.New("ejson private key must be 64 hex characters")
+	}
+	var key [32]byte
+	copy(key[:], keyBytes)
+
+	decrypted, err := decryptEjson(data, &key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.FilePath, err)
+	}
+	return decrypted, nil
+}
+
+func decryptEjson(in interface{}, key *[32]byte) (interface{}, error) {
+	switch value := in.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, v := range value {
+			if strings.HasPrefix(k, "_") {
+				out[k] = v
+				continue
+			}
+			decrypted, err := decryptEjson(v, key)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = decrypted
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, v := range value {
+			decrypted, err := decryptEjson(v, key)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = decrypted
+		}
+		return out, nil
+	case string:
+		return decryptEjsonValue(value, key)
+	}
+	return in, nil
+}
+
+func decryptEjsonValue(value string, key *[32]byte) (string, error) {
+	parts := ejsonValue.FindStringSubmatch(value)
+	if parts == nil {
+		return value, nil
+	}
+	var encrypterKey [32]byte
+	var nonce [24]byte
+	pub, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	n, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	boxed, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", err
+	}
+	copy(encrypterKey[:], pub)
+	copy(nonce[:], n)
+	plain, ok := box.Open(nil, boxed, &nonce, &encrypterKey, key)
+	if !ok {
+		return "", errors.New("unable to decrypt ejson value, wrong private key?")
+	}
+	return string(plain), nil
+}
+
+// load reads a file through the kustomize loader when there is one,
+// relative paths are relative to the loader root
+func load(ldr Loader, path string) ([]byte, error) {
+	if ldr == nil {
+		return ioutil.ReadFile(path)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ldr.Root(), path)
+	}
+	return ldr.Load(path)
+}
@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FileSource reads a plain YAML or JSON file.
+type FileSource struct {
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	ldr  Loader
+}
+
+func (s *FileSource) withLoader(ldr Loader) *FileSource {
+	c := *s
+	c.ldr = ldr
+	return &c
+}
+
+// Read returns the parsed content of the file.
+func (s *FileSource) Read() (interface{}, error) {
+	content, err := load(s.ldr, s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	err = yaml.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	return data, nil
+}
+
+// EnvSource reads environment variables, only those starting with Prefix
+// when it is set, the prefix is removed from the keys.
+type EnvSource struct {
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+}
+
+// Read returns a map of the environment variables.
+func (s *EnvSource) Read() (interface{}, error) {
+	data := map[string]interface{}{}
+	for _, env := range os.Environ() {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], s.Prefix) {
+			continue
+		}
+		data[strings.TrimPrefix(parts[0], s.Prefix)] = parts[1]
+	}
+	return data, nil
+}
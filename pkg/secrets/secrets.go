@@ -0,0 +1,81 @@
+// Package secrets reads the data that qlik.com/v1 plugins template into
+// resources from ejson, Vault, SOPS, plain files or the environment.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SecretSource reads secret data, usually a map, for templating.
+type SecretSource interface {
+	Read() (interface{}, error)
+}
+
+// Loader loads files relative to a kustomization, ifc.Loader satisfies it.
+type Loader interface {
+	Root() string
+	Load(location string) ([]byte, error)
+}
+
+const (
+	EjsonType = "ejson"
+	VaultType = "vault"
+	SopsType  = "sops"
+	FileType  = "file"
+	EnvType   = "env"
+)
+
+// DataSource is the dataSource section of a plugin config. Type selects the
+// source, when it is empty ejson is used if a private key is available and
+// Vault if a vault section is given, as the plugins always did.
+type DataSource struct {
+	Type  string       `json:"type,omitempty" yaml:"type,omitempty"`
+	Ejson *EjsonSource `json:"ejson,omitempty" yaml:"ejson,omitempty"`
+	Vault *VaultSource `json:"vault,omitempty" yaml:"vault,omitempty"`
+	Sops  *SopsSource  `json:"sops,omitempty" yaml:"sops,omitempty"`
+	File  *FileSource  `json:"file,omitempty" yaml:"file,omitempty"`
+	Env   *EnvSource   `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// Source returns the SecretSource selected by the data source config.
+func (ds *DataSource) Source(ldr Loader) (SecretSource, error) {
+	switch ds.Type {
+	case EjsonType:
+		if ds.Ejson == nil {
+			return nil, errors.New("dataSource type ejson requires an ejson section")
+		}
+		return ds.Ejson.withLoader(ldr), nil
+	case VaultType:
+		if ds.Vault == nil {
+			return nil, errors.New("dataSource type vault requires a vault section")
+		}
+		return ds.Vault, nil
+	case SopsType:
+		if ds.Sops == nil {
+			return nil, errors.New("dataSource type sops requires a sops section")
+		}
+		return ds.Sops.withLoader(ldr), nil
+	case FileType:
+		if ds.File == nil {
+			return nil, errors.New("dataSource type file requires a file section")
+		}
+		return ds.File.withLoader(ldr), nil
+	case EnvType:
+		if ds.Env == nil {
+			return &EnvSource{}, nil
+		}
+		return ds.Env, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown dataSource type %q", ds.Type)
+	}
+
+	if ds.Ejson != nil && ds.Ejson.hasKey() {
+		return ds.Ejson.withLoader(ldr), nil
+	}
+	if ds.Vault != nil {
+		return ds.Vault, nil
+	}
+	return nil, errors.New("no dataSource available, set a type, an ejson key or a vault section")
+}
@@ -0,0 +1,267 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// encryptEjson encrypts a value the way the ejson tool does
+func encryptEjson(t *testing.T, plain string, publicKey *[32]byte) string {
+	encrypterPub, encrypterPriv, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	require.NoError(t, err)
+	boxed := box.Seal(nil, []byte(plain), &nonce, publicKey, encrypterPriv)
+	return fmt.Sprintf("EJ[1:%s:%s:%s]",
+		base64.StdEncoding.EncodeToString(encrypterPub[:]),
+		base64.StdEncoding.EncodeToString(nonce[:]),
+		base64.StdEncoding.EncodeToString(boxed))
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestEjsonSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	filePath := writeFile(t, dir, "secrets.ejson", fmt.Sprintf(`{
+  "_public_key": "%s",
+  "mongodb": {"password": "%s"},
+  "tags": ["%s"]
+}`, hex.EncodeToString(publicKey[:]), encryptEjson(t, "s3cr3t", publicKey), encryptEjson(t, "a", publicKey)))
+	keyPath := writeFile(t, dir, "key", hex.EncodeToString(privateKey[:])+"\n")
+
+	ds := &DataSource{Ejson: &EjsonSource{FilePath: filePath, PrivateKeyPath: keyPath}}
+	source, err := ds.Source(nil)
+	require.NoError(t, err)
+	data, err := source.Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"_public_key": hex.EncodeToString(publicKey[:]),
+		"mongodb":     map[string]interface{}{"password": "s3cr3t"},
+		"tags":        []interface{}{"a"},
+	}, data)
+
+	_, wrongKey, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeFile(t, dir, "key", hex.EncodeToString(wrongKey[:]))
+	_, err = source.Read()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong private key")
+}
+
+func TestVaultSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/qliksense":
+			fmt.Fprint(w, `{"data": {"password": "v1"}}`)
+		case "/v1/secret/data/qliksense":
+			fmt.Fprint(w, `{"data": {"data": {"password": "v2"}, "metadata": {"version": 3}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	data, err := (&VaultSource{Address: server.URL, Token: "token", SecretPath: "kv/qliksense"}).Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"password": "v1"}, data)
+
+	data, err = (&VaultSource{Address: server.URL + "/", Token: "token\n", SecretPath: "/secret/qliksense", KVVersion: 2}).Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"password": "v2"}, data)
+
+	_, err = (&VaultSource{Address: server.URL, Token: "wrong", SecretPath: "kv/qliksense"}).Read()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "403")
+}
+
+func TestVaultAuth(t *testing.T) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			logins++
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"errors": ["invalid role or secret ID"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"auth": {"client_token": "approle-token"}}`)
+		case "/v1/auth/k8s/login":
+			logins++
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["role"] != "qliksense" || body["jwt"] != "jwt" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"auth": {"client_token": "k8s-token"}}`)
+		case "/v1/kv/qliksense":
+			token := r.Header.Get("X-Vault-Token")
+			if token != "approle-token" && token != "k8s-token" && token != "file-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"data": {"token": %q}}`, token)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addressPath := writeFile(t, dir, "address", server.URL+"\n")
+	tokenPath := writeFile(t, dir, "token", "file-token\n")
+	secretIDPath := writeFile(t, dir, "secret-id", "secret\n")
+	jwtPath := writeFile(t, dir, "jwt", "jwt\n")
+
+	data, err := (&VaultSource{AddressPath: addressPath, TokenPath: tokenPath, SecretPath: "kv/qliksense"}).Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"token": "file-token"}, data)
+
+	approle := &VaultSource{
+		AddressPath: addressPath,
+		SecretPath:  "kv/qliksense",
+		Auth:        &VaultAuth{Method: AppRoleAuth, RoleID: "role", SecretIDPath: secretIDPath},
+	}
+	for i := 0; i < 2; i++ {
+		data, err = approle.Read()
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{"token": "approle-token"}, data)
+	}
+	require.Equal(t, 1, logins, "the approle token should be cached")
+
+	data, err = (&VaultSource{
+		Address:    server.URL,
+		SecretPath: "kv/qliksense",
+		Auth:       &VaultAuth{Method: KubernetesAuth, Mount: "k8s", Role: "qliksense", JWTPath: jwtPath},
+	}).Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"token": "k8s-token"}, data)
+
+	_, err = (&VaultSource{
+		Address:    server.URL,
+		SecretPath: "kv/qliksense",
+		Auth:       &VaultAuth{Method: AppRoleAuth, RoleID: "role", SecretID: "wrong"},
+	}).Read()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid role or secret ID")
+
+	os.Unsetenv("VAULT_ADDR")
+	os.Unsetenv("VAULT_TOKEN")
+	for source, message := range map[*VaultSource]string{
+		{Token: "token", SecretPath: "kv/qliksense"}:                                      "no address",
+		{Address: server.URL, SecretPath: "kv/qliksense"}:                                 "no token",
+		{Address: server.URL, TokenPath: filepath.Join(dir, "missing")}:                   "tokenPath",
+		{Address: server.URL, Auth: &VaultAuth{Method: AppRoleAuth, RoleID: "role"}}:      "requires roleId and secretId",
+		{Address: server.URL, Auth: &VaultAuth{Method: "ldap"}}:                           `unknown auth method "ldap"`,
+		{Address: server.URL, Token: "file-token"}:                                        "secretPath is not set",
+		{Address: server.URL, Token: "file-token", SecretPath: "kv", KVVersion: 2}:        "must be <mount>/<path>",
+		{Address: server.URL, Auth: &VaultAuth{Method: KubernetesAuth, JWTPath: jwtPath}}: "requires a role",
+	} {
+		_, err = source.Read()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), message)
+	}
+}
+
+func TestFileAndEnvSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "values.yaml", "region: us-east-1\n")
+
+	ds := &DataSource{Type: FileType, File: &FileSource{Path: "values.yaml"}}
+	source, err := ds.Source(fakeLoader{root: dir})
+	require.NoError(t, err)
+	data, err := source.Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"region": "us-east-1"}, data)
+
+	os.Setenv("QLIK_TEST_REGION", "eu-west-1")
+	defer os.Unsetenv("QLIK_TEST_REGION")
+	ds = &DataSource{Type: EnvType, Env: &EnvSource{Prefix: "QLIK_TEST_"}}
+	source, err = ds.Source(nil)
+	require.NoError(t, err)
+	data, err = source.Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"REGION": "eu-west-1"}, data)
+}
+
+func TestSopsSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// a stand-in for the sops binary that prints the file it is given
+	sopsBin := writeFile(t, dir, "sops", "#!/bin/sh\ncat \"$2\"\n")
+	require.NoError(t, os.Chmod(sopsBin, 0755))
+	filePath := writeFile(t, dir, "secrets.yaml", "password: s3cr3t\n")
+
+	data, err := (&SopsSource{FilePath: filePath, SopsBin: sopsBin}).Read()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"password": "s3cr3t"}, data)
+}
+
+func TestDataSourceSelection(t *testing.T) {
+	os.Unsetenv("EJSON_KEY")
+	ds := &DataSource{Ejson: &EjsonSource{FilePath: "secrets.ejson"}}
+	_, err := ds.Source(nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no dataSource available")
+
+	ds.Vault = &VaultSource{Address: "http://vault:8200", Token: "token"}
+	source, err := ds.Source(nil)
+	require.NoError(t, err)
+	require.IsType(t, &VaultSource{}, source)
+
+	os.Setenv("EJSON_KEY", "key")
+	defer os.Unsetenv("EJSON_KEY")
+	source, err = ds.Source(nil)
+	require.NoError(t, err)
+	require.IsType(t, &EjsonSource{}, source)
+
+	_, err = (&DataSource{Type: "keychain"}).Source(nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown dataSource type "keychain"`)
+}
+
+type fakeLoader struct {
+	root string
+}
+
+func (l fakeLoader) Root() string {
+	return l.root
+}
+
+func (l fakeLoader) Load(location string) ([]byte, error) {
+	return ioutil.ReadFile(location)
+}
@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SopsSource decrypts a SOPS encrypted YAML or JSON file with the sops binary.
+type SopsSource struct {
+	FilePath string `json:"filePath,omitempty" yaml:"filePath,omitempty"`
+	SopsBin  string `json:"sopsBin,omitempty" yaml:"sopsBin,omitempty"`
+	ldr      Loader
+}
+
+func (s *SopsSource) withLoader(ldr Loader) *SopsSource {
+	c := *s
+	c.ldr = ldr
+	return &c
+}
+
+// Read returns the decrypted content of the file.
+func (s *SopsSource) Read() (interface{}, error) {
+	sopsBin := s.SopsBin
+	if sopsBin == "" {
+		sopsBin = "sops"
+	}
+	filePath := s.FilePath
+	if s.ldr != nil && !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(s.ldr.Root(), filePath)
+	}
+
+	sopsCmd := exec.Command(sopsBin, "--decrypt", filePath)
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	sopsCmd.Stdout = &out
+	sopsCmd.Stderr = &stderr
+	err := sopsCmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("sops --decrypt %s: %v: %s", s.FilePath, err, stderr.String())
+	}
+
+	var data interface{}
+	err = yaml.Unmarshal(out.Bytes(), &data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.FilePath, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,243 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	TokenAuth      = "token"
+	AppRoleAuth    = "approle"
+	KubernetesAuth = "kubernetes"
+
+	defaultJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// VaultSource reads a secret from a Vault KV secrets engine. For KV version 2
+// the first segment of SecretPath is the mount, secret/qliksense is read from
+// secret/data/qliksense.
+type VaultSource struct {
+	// Address is taken from Address, the file at AddressPath or VAULT_ADDR
+	Address     string `json:"address,omitempty" yaml:"address,omitempty"`
+	AddressPath string `json:"addressPath,omitempty" yaml:"addressPath,omitempty"`
+	// Token is used by token auth, it is taken from Token, the file at
+	// TokenPath or VAULT_TOKEN
+	Token      string       `json:"token,omitempty" yaml:"token,omitempty"`
+	TokenPath  string       `json:"tokenPath,omitempty" yaml:"tokenPath,omitempty"`
+	Auth       *VaultAuth   `json:"auth,omitempty" yaml:"auth,omitempty"`
+	SecretPath string       `json:"secretPath,omitempty" yaml:"secretPath,omitempty"`
+	KVVersion  int          `json:"kvVersion,omitempty" yaml:"kvVersion,omitempty"`
+	Client     *http.Client `json:"-" yaml:"-"`
+}
+
+// VaultAuth logs in to Vault to get a token, Method is token (the default),
+// approle or kubernetes.
+type VaultAuth struct {
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// Mount is the path the auth method is enabled at, it defaults to the method
+	Mount string `json:"mount,omitempty" yaml:"mount,omitempty"`
+	// RoleID and SecretID, or the files holding them, are used by approle
+	RoleID       string `json:"roleId,omitempty" yaml:"roleId,omitempty"`
+	RoleIDPath   string `json:"roleIdPath,omitempty" yaml:"roleIdPath,omitempty"`
+	SecretID     string `json:"secretId,omitempty" yaml:"secretId,omitempty"`
+	SecretIDPath string `json:"secretIdPath,omitempty" yaml:"secretIdPath,omitempty"`
+	// Role and the service account token at JWTPath are used by kubernetes
+	Role    string `json:"role,omitempty" yaml:"role,omitempty"`
+	JWTPath string `json:"jwtPath,omitempty" yaml:"jwtPath,omitempty"`
+}
+
+// vaultTokens caches tokens from logins so that a build logs in once
+// per Vault address and credentials, however many plugins read secrets
+var vaultTokens = struct {
+	sync.Mutex
+	byKey map[string]string
+}{byKey: map[string]string{}}
+
+// Read returns the data of the secret.
+func (s *VaultSource) Read() (interface{}, error) {
+	address, err := s.address()
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.token(address)
+	if err != nil {
+		return nil, err
+	}
+
+	secretPath := strings.Trim(s.SecretPath, "/")
+	if secretPath == "" {
+		return nil, errors.New("vault: secretPath is not set")
+	}
+	if s.KVVersion == 2 {
+		parts := strings.SplitN(secretPath, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("vault: secretPath %q must be <mount>/<path> for kv version 2", s.SecretPath)
+		}
+		secretPath = parts[0] + "/data/" + parts[1]
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = s.do("GET", address+"/v1/"+secretPath, token, nil, &secret)
+	if err != nil {
+		return nil, fmt.Errorf("vault: read %s: %v", s.SecretPath, err)
+	}
+	if s.KVVersion == 2 {
+		return secret.Data["data"], nil
+	}
+	return secret.Data, nil
+}
+
+func (s *VaultSource) address() (string, error) {
+	address, err := valueOrFile(s.Address, s.AddressPath, "VAULT_ADDR")
+	if err != nil {
+		return "", fmt.Errorf("vault: addressPath: %v", err)
+	}
+	if address == "" {
+		return "", errors.New("vault: no address, set address, addressPath or VAULT_ADDR")
+	}
+	return strings.TrimRight(address, "/"), nil
+}
+
+func (s *VaultSource) token(address string) (string, error) {
+	auth := s.Auth
+	if auth == nil {
+		auth = &VaultAuth{}
+	}
+	switch auth.Method {
+	case "", TokenAuth:
+		token, err := valueOrFile(s.Token, s.TokenPath, "VAULT_TOKEN")
+		if err != nil {
+			return "", fmt.Errorf("vault: tokenPath: %v", err)
+		}
+		if token == "" {
+			return "", errors.New("vault: no token, set token, tokenPath or VAULT_TOKEN")
+		}
+		return token, nil
+	case AppRoleAuth:
+		roleID, err := valueOrFile(auth.RoleID, auth.RoleIDPath, "")
+		if err != nil {
+			return "", fmt.Errorf("vault: roleIdPath: %v", err)
+		}
+		secretID, err := valueOrFile(auth.SecretID, auth.SecretIDPath, "")
+		if err != nil {
+			return "", fmt.Errorf("vault: secretIdPath: %v", err)
+		}
+		if roleID == "" || secretID == "" {
+			return "", errors.New("vault: approle auth requires roleId and secretId")
+		}
+		return s.login(address, auth.mount(), map[string]string{"role_id": roleID, "secret_id": secretID})
+	case KubernetesAuth:
+		jwtPath := auth.JWTPath
+		if jwtPath == "" {
+			jwtPath = defaultJWTPath
+		}
+		jwt, err := valueOrFile("", jwtPath, "")
+		if err != nil {
+			return "", fmt.Errorf("vault: jwtPath: %v", err)
+		}
+		if auth.Role == "" || jwt == "" {
+			return "", errors.New("vault: kubernetes auth requires a role and a service account token")
+		}
+		return s.login(address, auth.mount(), map[string]string{"role": auth.Role, "jwt": jwt})
+	}
+	return "", fmt.Errorf("vault: unknown auth method %q, expected one of %s, %s or %s",
+		auth.Method, TokenAuth, AppRoleAuth, KubernetesAuth)
+}
+
+func (a *VaultAuth) mount() string {
+	if a.Mount != "" {
+		return strings.Trim(a.Mount, "/")
+	}
+	return a.Method
+}
+
+// login exchanges credentials for a client token, tokens are cached for
+// the lifetime of the process
+func (s *VaultSource) login(address string, mount string, credentials map[string]string) (string, error) {
+	body, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+	key := address + "|" + mount + "|" + string(body)
+
+	vaultTokens.Lock()
+	defer vaultTokens.Unlock()
+	if token, ok := vaultTokens.byKey[key]; ok {
+		return token, nil
+	}
+
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err = s.do("POST", address+"/v1/auth/"+mount+"/login", "", body, &response)
+	if err != nil {
+		return "", fmt.Errorf("vault: %s login: %v", mount, err)
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault: %s login returned no token", mount)
+	}
+	vaultTokens.byKey[key] = response.Auth.ClientToken
+	return response.Auth.ClientToken, nil
+}
+
+// do sends a request to Vault and decodes the JSON response, Vault's
+// own error messages are included in the returned error
+func (s *VaultSource) do(method string, url string, token string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&vaultErr)
+		if len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("%s: %s", resp.Status, strings.Join(vaultErr.Errors, ", "))
+		}
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// valueOrFile returns value, else the trimmed content of the file at
+// path, else the environment variable env
+func valueOrFile(value string, path string, env string) (string, error) {
+	if value != "" {
+		return strings.TrimSpace(value), nil
+	}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	if env != "" {
+		return strings.TrimSpace(os.Getenv(env)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,22 @@
+// Package selectors checks the kustomize selectors of the plugin configs,
+// kustomize compiles their name and namespace as regexes when it selects and
+// panics on those that are not.
+package selectors
+
+import (
+	"fmt"
+	"regexp"
+
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+)
+
+// Validate returns an error when the name or namespace of s is not a regex.
+func Validate(s types.Selector) error {
+	if _, err := regexp.Compile(s.Name); err != nil {
+		return fmt.Errorf("name: %v", err)
+	}
+	if _, err := regexp.Compile(s.Namespace); err != nil {
+		return fmt.Errorf("namespace: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package selectors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+)
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(types.Selector{}))
+	require.NoError(t, Validate(types.Selector{Name: "^engine$", Namespace: "qlik.*"}))
+	require.EqualError(t, Validate(types.Selector{Name: "engine["}),
+		"name: error parsing regexp: missing closing ]: `[`")
+	require.EqualError(t, Validate(types.Selector{Namespace: "(qlik"}),
+		"namespace: error parsing regexp: missing closing ): `(qlik`")
+}
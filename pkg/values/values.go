@@ -0,0 +1,78 @@
+// Package values merges and copies Helm values the same way in every plugin.
+//
+// Merge is the merge of the plugins, a null deletes and false, "" and 0 are
+// values like any other. HelmValues has always merged with mergo, which
+// treats them as unset, and keeps doing so through MergeLegacy so that the
+// HelmValues of existing configs render as they did.
+package values
+
+import (
+	"github.com/imdario/mergo"
+	"sigs.k8s.io/yaml"
+)
+
+// Merge deep merges high over low without modifying either. Maps are merged
+// key by key, lists and scalars in high replace those in low and a null in
+// high deletes the key, nulls left in low are dropped.
+func Merge(low map[string]interface{}, high map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(low))
+	for key, value := range low {
+		if value != nil {
+			merged[key] = value
+		}
+	}
+	for key, value := range high {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = MergeValue(merged[key], value)
+	}
+	return merged
+}
+
+// MergeValue merges high over low when both are maps, otherwise high wins
+// unless it is nil.
+func MergeValue(low interface{}, high interface{}) interface{} {
+	if high == nil {
+		return low
+	}
+	highMap, highIsMap := high.(map[string]interface{})
+	lowMap, lowIsMap := low.(map[string]interface{})
+	if highIsMap && lowIsMap {
+		return Merge(lowMap, highMap)
+	}
+	return high
+}
+
+// MergeLegacy merges high into low as HelmValues does. Without overwrite high
+// only fills in what low has not set or has set to false, "" or 0, with
+// overwrite high wins, false and "" included. A null in high never deletes,
+// it leaves what low has set.
+func MergeLegacy(low interface{}, high interface{}, overwrite bool) (interface{}, error) {
+	var merged map[interface{}]interface{}
+	// the values are wrapped, mergo only merges maps and structs
+	if err := mergeLegacy(&merged, map[interface{}]interface{}{"root": low}, overwrite); err != nil {
+		return nil, err
+	}
+	if err := mergeLegacy(&merged, map[interface{}]interface{}{"root": high}, overwrite); err != nil {
+		return nil, err
+	}
+	return merged["root"], nil
+}
+
+func mergeLegacy(dst interface{}, src interface{}, overwrite bool) error {
+	if overwrite {
+		return mergo.Merge(dst, src, mergo.WithOverride)
+	}
+	return mergo.Merge(dst, src)
+}
+
+// DeepCopy copies in to out through YAML, out must be a pointer.
+func DeepCopy(in interface{}, out interface{}) error {
+	b, err := yaml.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, out)
+}
@@ -0,0 +1,74 @@
+package values
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	low := map[string]interface{}{
+		"image":    "engine",
+		"replicas": 1,
+		"debug":    true,
+		"hosts":    []interface{}{"a", "b"},
+		"mongodb":  map[string]interface{}{"database": "qliksense", "uri": "mongodb://low"},
+		"stale":    nil,
+	}
+	high := map[string]interface{}{
+		"replicas": 3,
+		"debug":    nil,
+		"hosts":    []interface{}{"c"},
+		"mongodb":  map[string]interface{}{"uri": "mongodb://high"},
+		"enabled":  false,
+	}
+
+	merged := Merge(low, high)
+	require.Equal(t, map[string]interface{}{
+		"image":    "engine",
+		"replicas": 3,
+		"hosts":    []interface{}{"c"},
+		"mongodb":  map[string]interface{}{"database": "qliksense", "uri": "mongodb://high"},
+		"enabled":  false,
+	}, merged)
+
+	// the inputs are left as they were
+	require.Equal(t, "mongodb://low", low["mongodb"].(map[string]interface{})["uri"])
+	require.Contains(t, high, "debug")
+
+	require.Equal(t, map[string]interface{}{"a": 1}, Merge(nil, map[string]interface{}{"a": 1}))
+}
+
+func TestMergeValue(t *testing.T) {
+	require.Equal(t, "low", MergeValue("low", nil))
+	require.Equal(t, "high", MergeValue(map[string]interface{}{"a": 1}, "high"))
+	require.Equal(t, map[string]interface{}{"a": 1, "b": 2},
+		MergeValue(map[string]interface{}{"a": 1}, map[string]interface{}{"b": 2}))
+}
+
+func TestMergeLegacy(t *testing.T) {
+	low := map[string]interface{}{"enabled": false, "debug": true, "name": "", "replicas": 0, "keep": "kept"}
+	high := map[string]interface{}{"enabled": true, "debug": false, "name": "qliksense", "replicas": 2, "keep": nil}
+
+	// unlike Merge, false, "" and 0 in low are filled in and nulls in high
+	// are ignored
+	merged, err := MergeLegacy(low, high, false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"enabled": true, "debug": true, "name": "qliksense", "replicas": 2, "keep": "kept",
+	}, merged)
+
+	merged, err = MergeLegacy(low, high, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"enabled": true, "debug": false, "name": "qliksense", "replicas": 2, "keep": "kept",
+	}, merged)
+}
+
+func TestDeepCopy(t *testing.T) {
+	in := map[string]interface{}{"nested": map[string]interface{}{"a": "b"}}
+	var out map[string]interface{}
+	require.NoError(t, DeepCopy(in, &out))
+	out["nested"].(map[string]interface{})["a"] = "c"
+	require.Equal(t, "b", in["nested"].(map[string]interface{})["a"])
+}
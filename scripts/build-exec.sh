@@ -0,0 +1,17 @@
+PROJECT_DIR="$( pwd )"
+DEST_DIR=$HOME/.config/kustomize
+if [ ! -z "${XDG_CONFIG_HOME}" ]; then
+DEST_DIR=$XDG_CONFIG_HOME/kustomize
+fi
+
+# one binary serves every kind, kustomize runs it as an exec plugin under
+# each kind's name and kpt or kustomize fn run it as a KRM function
+mkdir -p $PROJECT_DIR/bin
+cd $PROJECT_DIR/pkg
+GO111MODULE=on go build -o $PROJECT_DIR/bin/qlik-plugins ./cmd/qlik-plugins || exit 1
+
+for kind in ChartHomeFullPath Gomplate HelmChart HelmValues SelectivePatch ValuesFile; do
+  dir=$DEST_DIR/plugin/qlik.com/v1/$(echo $kind | tr '[:upper:]' '[:lower:]')
+  mkdir -p $dir
+  ln -sf $PROJECT_DIR/bin/qlik-plugins $dir/$kind
+done
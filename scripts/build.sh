@@ -3,7 +3,9 @@ KUSTOMIZE_DIR="$(pwd)/kustomize"
 DEST_DIR=$HOME/.config/kustomize
 
 cd $KUSTOMIZE_DIR
-find . -iname '*.go' -exec sh -c 'f="{}"; GO111MODULE=on go build -buildmode plugin -o "${f/go/so}" $f' \;
+# build from each plugin directory so its go.mod, and the replace of the
+# shared pkg module, is used
+find . -iname '*.go' ! -iname '*_test.go' -exec sh -c 'f="{}"; cd "$(dirname "$f")" && GO111MODULE=on go build -buildmode plugin -o "$(basename "${f%.go}").so" "$(basename "$f")"' \;
 if [ ! -z "${XDG_CONFIG_HOME}" ]; then
 DEST_DIR=$XDG_CONFIG_HOME
 fi